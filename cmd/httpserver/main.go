@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
@@ -11,20 +12,22 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/httpfromtcp/internal/headers"
 	"github.com/httpfromtcp/internal/request"
 	"github.com/httpfromtcp/internal/response"
+	"github.com/httpfromtcp/internal/router"
 	"github.com/httpfromtcp/internal/server"
 )
 
-const port = 42069
+const addr = ":42069"
 
-func routerHandler(w io.Writer, req *request.Request) *server.HandlerError {
-	rw := response.NewWriter(w)
+// shutdownTimeout is how long requests in flight get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
 
-	// Common HTML bodies
-	const html400 = `
+// Common HTML bodies
+const html400 = `
 <html>
   <head>
     <title>400 Bad Request</title>
@@ -34,7 +37,7 @@ func routerHandler(w io.Writer, req *request.Request) *server.HandlerError {
     <p>Your request honestly kinda sucked.</p>
   </body>
 </html>`
-	const html500 = `
+const html500 = `
 <html>
   <head>
     <title>500 Internal Server Error</title>
@@ -44,7 +47,7 @@ func routerHandler(w io.Writer, req *request.Request) *server.HandlerError {
     <p>Okay, you know what? This one is on me.</p>
   </body>
 </html>`
-	const html200 = `
+const html200 = `
 <html>
   <head>
     <title>200 OK</title>
@@ -55,115 +58,163 @@ func routerHandler(w io.Writer, req *request.Request) *server.HandlerError {
   </body>
 </html>`
 
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-		path := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-		up := "https://httpbin.org/" + path
-
-		resp, err := http.Get(up)
-		if err != nil {
-			_ = rw.WriteStatusLine(response.InternalServerError)
-			_ = rw.WriteHeaders(headers.NewHeaders())
-			_, _ = rw.WriteBody([]byte("upstream error\n"))
-			return nil
-		}
-		defer resp.Body.Close()
-
-		_ = rw.WriteStatusLine(response.StatusCode(resp.StatusCode))
+func newRouter() *router.Router {
+	r := router.New()
+	r.Handle("GET /yourproblem", page(response.BadRequest, html400))
+	r.Handle("GET /myproblem", page(response.InternalServerError, html500))
+	r.Handle("GET /video", videoHandler)
+	r.Handle("GET /httpbin/*path", httpbinHandler)
+	r.Handle("GET /*path", page(response.Ok, html200))
+	return r
+}
 
-		h := headers.NewHeaders()
-		if ct := resp.Header.Get("Content-Type"); ct != "" {
-			h.Set("content-type", ct)
-		}
-		h.Set("transfer-encoding", "chunked")
-		h.Set("trailer", "X-Content-Sha256, X-Content-Length")
-		_ = rw.WriteHeaders(h)
-
-		hasher := sha256.New()
-		var total int64
-
-		buf := make([]byte, 1024)
-		for {
-			n, rerr := resp.Body.Read(buf)
-			if n > 0 {
-				chunk := buf[:n]
-				_, err = hasher.Write(chunk)
-				if err != nil {
-					return nil
-				}
-				total += int64(n)
-
-				if _, err := rw.WriteChunkedBody(buf[:n]); err != nil {
-					log.Printf("client closed during chunk write: %v", err)
-					return nil
-				}
-			}
-			if rerr == io.EOF {
-				break
-			}
-			if rerr != nil {
-				break
-			}
+// logRequests logs the method, target, status and body size of every
+// request.
+func logRequests(next server.Handler) server.Handler {
+	return func(w io.Writer, req *request.Request) *server.HandlerError {
+		o := server.Observe(w)
+		he := next(o, req)
+		status := o.Status()
+		if he != nil {
+			status = he.StatusCode()
 		}
+		log.Printf("%s %s %d %d", req.RequestLine.Method, req.RequestLine.RequestTarget, status, o.BytesWritten())
+		return he
+	}
+}
 
-		sum := hasher.Sum(nil)
-		tr := headers.NewHeaders()
-		tr.Set("X-Content-SHA256", hex.EncodeToString(sum))
-		tr.Set("X-Content-Length", strconv.FormatInt(total, 10))
+func page(status response.StatusCode, html string) server.Handler {
+	return func(w io.Writer, req *request.Request) *server.HandlerError {
+		writeBody(response.NewWriter(w), status, "text/html", []byte(html))
+		return nil
+	}
+}
 
-		if err := rw.WriteTrailers(tr); err != nil {
-			return nil
-		}
+func videoHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	rw := response.NewWriter(w)
+	data, err := os.ReadFile("assets/vim.mp4")
+	if err != nil {
+		writeBody(rw, response.InternalServerError, "text/html", []byte(html500))
 		return nil
 	}
+	writeBody(rw, response.Ok, "video/mp4", data)
+	return nil
+}
 
+// writeBody writes a whole response; the writer works out the
+// content-length from the single write.
+func writeBody(rw *response.Writer, status response.StatusCode, contentType string, body []byte) {
 	h := headers.NewHeaders()
-	h.Set("content-type", "text/html")
+	h.Set("content-type", contentType)
+	_ = rw.WriteStatusLine(status)
+	_ = rw.WriteHeaders(h)
+	_, _ = rw.WriteBody(body)
+}
 
-	switch req.RequestLine.RequestTarget {
-	case "/yourproblem":
-		_ = rw.WriteStatusLine(response.BadRequest)
-		_ = rw.WriteHeaders(h)
-		_, _ = rw.WriteBody([]byte(html400))
-		return nil
+func httpbinHandler(w io.Writer, req *request.Request) *server.HandlerError {
+	rw := response.NewWriter(w)
+	up := "https://httpbin.org/" + strings.TrimPrefix(req.Target.RawPath, "/httpbin/")
+	if req.Target.RawQuery != "" {
+		up += "?" + req.Target.RawQuery
+	}
 
-	case "/myproblem":
+	resp, err := http.Get(up)
+	if err != nil {
 		_ = rw.WriteStatusLine(response.InternalServerError)
-		_ = rw.WriteHeaders(h)
-		_, _ = rw.WriteBody([]byte(html500))
+		_ = rw.WriteHeaders(headers.NewHeaders())
+		_, _ = rw.WriteBody([]byte("upstream error\n"))
 		return nil
-	case "/video":
-		data, err := os.ReadFile("assets/vim.mp4")
-		if err != nil {
-			_ = rw.WriteStatusLine(response.InternalServerError)
-			_ = rw.WriteHeaders(h)
-			_, _ = rw.WriteBody([]byte(html500))
-			return nil
+	}
+	defer resp.Body.Close()
+
+	// keep upstream's reason phrase, whatever the code
+	reason := strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" ")
+	_ = rw.WriteStatusLineReason(response.StatusCode(resp.StatusCode), reason)
+
+	h := headers.NewHeaders()
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		h.Set("content-type", ct)
+	}
+	for _, cookie := range resp.Header.Values("Set-Cookie") {
+		h.Add("set-cookie", cookie)
+	}
+	h.Set("transfer-encoding", "chunked")
+	h.Set("trailer", "X-Content-Sha256, X-Content-Length")
+	_ = rw.WriteHeaders(h)
+
+	hasher := sha256.New()
+	var total int64
+
+	buf := make([]byte, 1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			_, err = hasher.Write(chunk)
+			if err != nil {
+				return nil
+			}
+			total += int64(n)
+
+			if _, err := rw.WriteChunkedBody(buf[:n]); err != nil {
+				log.Printf("client closed during chunk write: %v", err)
+				return nil
+			}
 		}
-		v := headers.NewHeaders()
-		v.Set("content-type", "video/mp4")
-		_ = rw.WriteStatusLine(response.Ok)
-		_ = rw.WriteHeaders(v)
-		_, _ = rw.WriteBody([]byte(data))
-		return nil
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			break
+		}
+	}
 
-	default:
-		_ = rw.WriteStatusLine(response.Ok)
-		_ = rw.WriteHeaders(h)
-		_, _ = rw.WriteBody([]byte(html200))
+	sum := hasher.Sum(nil)
+	tr := headers.NewHeaders()
+	tr.Set("X-Content-SHA256", hex.EncodeToString(sum))
+	tr.Set("X-Content-Length", strconv.FormatInt(total, 10))
+
+	if err := rw.WriteTrailers(tr); err != nil {
 		return nil
 	}
+	return nil
 }
 
 func main() {
-	server, err := server.Serve(routerHandler, port)
-	if err != nil {
+	srv := server.New(server.Config{
+		Addr:    addr,
+		Handler: server.Chain(newRouter().Handler(), logRequests),
+	})
+	if err := srv.Start(); err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	log.Println("Server started on", srv.Addr())
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	select {
+	case <-sigChan:
+	case <-waitErr(srv):
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server stopped with requests in flight: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
+
+// waitErr logs the error the server stops on if it stops by itself.
+func waitErr(srv *server.Server) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		if err := srv.Wait(); err != nil {
+			log.Printf("Server stopped: %v", err)
+		}
+		close(done)
+	}()
+	return done
+}
@@ -21,7 +21,9 @@ func main() {
 			log.Fatalf("failed to accept, %s", err)
 			break
 		}
-		r, err := request.RequestFromReader(conn)
+		// the client keeps the connection open waiting for an answer, so
+		// read the one request rather than the whole stream
+		r, err := request.NewReader(conn).ReadRequest()
 
 		if err != nil {
 			log.Fatalf("failed to request from reader %s", err)
@@ -32,7 +34,7 @@ func main() {
 		fmt.Println("- Target:", r.RequestLine.RequestTarget)
 		fmt.Println("- Version:", r.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for k, v := range r.Headers {
+		for k, v := range r.Headers.All() {
 			fmt.Printf("- %s: %s\n", k, v)
 		}
 		fmt.Println("Body:")
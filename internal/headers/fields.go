@@ -0,0 +1,355 @@
+package headers
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Typed accessors for common fields. A missing field is not an error: the
+// getters return the zero value, or -1 for ContentLength. A field that is
+// present but can't be parsed fails with ErrInvalidHeaderValue.
+
+// TimeFormat is the IMF-fixdate layout HTTP-dates are written in.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// the obsolete HTTP-date formats recipients still have to accept
+const (
+	rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+// ContentLength returns the length declared by Content-Length, or -1 if
+// there is none. Repeated fields, or a list in one, are only accepted when
+// every member is the same valid length.
+func (h *Headers) ContentLength() (int64, error) {
+	vals := h.Values("Content-Length")
+	if vals == nil {
+		return -1, nil
+	}
+
+	length := int64(-1)
+	for _, val := range vals {
+		for member := range strings.SplitSeq(val, ",") {
+			member = strings.TrimSpace(member)
+			if !isDigits(member) {
+				return 0, fmt.Errorf("%w: Content-Length %q", ErrInvalidHeaderValue, val)
+			}
+			// any number of leading zeros is allowed, but not a length
+			// too large for an int64
+			n, err := strconv.ParseInt("0"+strings.TrimLeft(member, "0"), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: Content-Length %q", ErrInvalidHeaderValue, val)
+			}
+			if length != -1 && n != length {
+				return 0, fmt.Errorf("%w: conflicting Content-Length %d and %d", ErrInvalidHeaderValue, length, n)
+			}
+			length = n
+		}
+	}
+	return length, nil
+}
+
+func (h *Headers) SetContentLength(n int64) error {
+	return h.Set("Content-Length", strconv.FormatInt(n, 10))
+}
+
+// MediaType is a media type with its parameters, as found in Content-Type.
+type MediaType struct {
+	// Type is the lower-cased type and subtype, such as "text/html".
+	Type string
+	// Params holds the parameters by lower-cased name, with quoted values
+	// unquoted.
+	Params map[string]string
+}
+
+// String formats m for a header, quoting parameter values that need it.
+// Parameters are written sorted by name.
+func (m MediaType) String() string {
+	var b strings.Builder
+	b.WriteString(m.Type)
+	names := make([]string, 0, len(m.Params))
+	for name := range m.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("; ")
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(quote(m.Params[name]))
+	}
+	return b.String()
+}
+
+// ParseMediaType parses a media type with optional parameters, RFC 9110
+// section 8.3.1.
+func ParseMediaType(s string) (MediaType, error) {
+	typ, rest, _ := strings.Cut(s, ";")
+	typ = strings.TrimSpace(typ)
+	main, sub, ok := strings.Cut(typ, "/")
+	if !ok || !IsToken(main) || !IsToken(sub) {
+		return MediaType{}, fmt.Errorf("%w: media type %q", ErrInvalidHeaderValue, s)
+	}
+
+	m := MediaType{Type: strings.ToLower(typ), Params: map[string]string{}}
+	if err := parseParams(m.Params, rest); err != nil {
+		return MediaType{}, fmt.Errorf("%w in %q", err, s)
+	}
+	return m, nil
+}
+
+// ContentType returns the parsed Content-Type.
+func (h *Headers) ContentType() (MediaType, error) {
+	val, ok := h.Get("Content-Type")
+	if !ok {
+		return MediaType{}, nil
+	}
+	return ParseMediaType(val)
+}
+
+func (h *Headers) SetContentType(m MediaType) error {
+	return h.Set("Content-Type", m.String())
+}
+
+// ParseTime parses an HTTP-date in IMF-fixdate or either of the obsolete
+// RFC 850 and asctime formats, RFC 9110 section 5.6.7.
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, rfc850Format, asctimeFormat} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: date %q", ErrInvalidHeaderValue, s)
+}
+
+// Time returns the HTTP-date in the field key.
+func (h *Headers) Time(key string) (time.Time, error) {
+	val, ok := h.Get(key)
+	if !ok {
+		return time.Time{}, nil
+	}
+	return ParseTime(strings.TrimSpace(val))
+}
+
+// SetTime sets the field key to t as an IMF-fixdate.
+func (h *Headers) SetTime(key string, t time.Time) error {
+	return h.Set(key, t.UTC().Format(TimeFormat))
+}
+
+func (h *Headers) Date() (time.Time, error) {
+	return h.Time("Date")
+}
+
+func (h *Headers) LastModified() (time.Time, error) {
+	return h.Time("Last-Modified")
+}
+
+func (h *Headers) IfModifiedSince() (time.Time, error) {
+	return h.Time("If-Modified-Since")
+}
+
+// Connection returns the lower-cased connection options, such as "close".
+func (h *Headers) Connection() []string {
+	var opts []string
+	for _, member := range h.list("Connection") {
+		opts = append(opts, strings.ToLower(member))
+	}
+	return opts
+}
+
+// HasConnectionOption reports whether Connection lists opt.
+func (h *Headers) HasConnectionOption(opt string) bool {
+	return slices.Contains(h.Connection(), strings.ToLower(opt))
+}
+
+// TransferEncoding returns the lower-cased transfer codings in the order
+// they were applied.
+func (h *Headers) TransferEncoding() ([]string, error) {
+	var codings []string
+	for _, member := range h.list("Transfer-Encoding") {
+		if !IsToken(member) {
+			return nil, fmt.Errorf("%w: transfer coding %q", ErrInvalidHeaderValue, member)
+		}
+		codings = append(codings, strings.ToLower(member))
+	}
+	return codings, nil
+}
+
+// MediaRange is one member of Accept: a media type that may use "*"
+// wildcards, and the weight the client gives it.
+type MediaRange struct {
+	MediaType
+	// Q is the weight from 0 to 1; 0 means not acceptable.
+	Q float64
+}
+
+// Accept returns the media ranges of Accept, most preferred first. Ranges
+// of equal weight keep the order the client sent them in.
+func (h *Headers) Accept() ([]MediaRange, error) {
+	var ranges []MediaRange
+	for _, member := range h.list("Accept") {
+		m, err := ParseMediaType(member)
+		if err != nil {
+			return nil, err
+		}
+		r := MediaRange{MediaType: m, Q: 1}
+		if q, ok := m.Params["q"]; ok {
+			if r.Q, err = parseQ(q); err != nil {
+				return nil, err
+			}
+			delete(m.Params, "q")
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Q > ranges[j].Q
+	})
+	return ranges, nil
+}
+
+// parseQ parses a qvalue: 0 or 1 with up to three decimals, and no more
+// than 1.
+func parseQ(s string) (float64, error) {
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole != "0" && whole != "1" || hasFrac && len(frac) > 3 || frac != "" && !isDigits(frac) {
+		return 0, fmt.Errorf("%w: qvalue %q", ErrInvalidHeaderValue, s)
+	}
+	q, _ := strconv.ParseFloat(s, 64)
+	if q > 1 {
+		return 0, fmt.Errorf("%w: qvalue %q", ErrInvalidHeaderValue, s)
+	}
+	return q, nil
+}
+
+// list splits the values of a comma-separated list field into its trimmed
+// members, skipping empty ones. Commas inside quoted strings are kept.
+func (h *Headers) list(key string) []string {
+	var members []string
+	for _, val := range h.Values(key) {
+		quoted, escaped := false, false
+		start := 0
+		for i := 0; i <= len(val); i++ {
+			if i < len(val) {
+				c := val[i]
+				switch {
+				case escaped:
+					escaped = false
+					continue
+				case quoted && c == '\\':
+					escaped = true
+					continue
+				case c == '"':
+					quoted = !quoted
+					continue
+				case c != ',' || quoted:
+					continue
+				}
+			}
+			if member := strings.TrimSpace(val[start:i]); member != "" {
+				members = append(members, member)
+			}
+			start = i + 1
+		}
+	}
+	return members
+}
+
+// parseParams parses the ";"-separated name=value parameters in s into
+// params. Empty parameters are allowed and skipped.
+func parseParams(params map[string]string, s string) error {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil
+		}
+		if s[0] == ';' {
+			s = s[1:]
+			continue
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq == -1 || !IsToken(s[:eq]) {
+			return fmt.Errorf("%w: invalid parameter", ErrInvalidHeaderValue)
+		}
+		name := strings.ToLower(s[:eq])
+		s = s[eq+1:]
+
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			var ok bool
+			val, s, ok = unquote(s)
+			if !ok {
+				return fmt.Errorf("%w: unterminated quoted string", ErrInvalidHeaderValue)
+			}
+		} else {
+			end := strings.IndexByte(s, ';')
+			if end == -1 {
+				end = len(s)
+			}
+			val, s = strings.TrimRight(s[:end], " \t"), s[end:]
+			if !IsToken(val) {
+				return fmt.Errorf("%w: invalid parameter value %q", ErrInvalidHeaderValue, val)
+			}
+		}
+		params[name] = val
+
+		s = strings.TrimLeft(s, " \t")
+		if s != "" && s[0] != ';' {
+			return fmt.Errorf("%w: junk after parameter %s", ErrInvalidHeaderValue, name)
+		}
+	}
+}
+
+// unquote reads the quoted-string at the start of s and returns its
+// contents and the rest of s.
+func unquote(s string) (string, string, bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], true
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", false
+			}
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", false
+}
+
+// quote returns s as is if it is a token, or else as a quoted-string.
+func quote(s string) string {
+	if IsToken(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,20 +2,57 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"iter"
 	"strings"
 )
 
-type Headers map[string]string
+var (
+	ErrMalformedHeader    = errors.New("malformed header")
+	ErrInvalidHeaderName  = errors.New("invalid header name")
+	ErrInvalidHeaderValue = errors.New("invalid header value")
+)
+
+// ObsFold is what Parse does with obsolete line folding: a field line
+// continued onto the next by starting that one with a space or tab.
+type ObsFold int
+
+const (
+	// RejectObsFold fails with ErrMalformedHeader.
+	RejectObsFold ObsFold = iota
+	// ReplaceObsFold joins the lines with a single space, as RFC 9112
+	// section 5.2 allows.
+	ReplaceObsFold
+)
+
+// Headers is an ordered list of fields, each with one or more values.
+// Lookups ignore the case of names, and repeated fields keep the position
+// of their first occurrence.
+type Headers struct {
+	// ObsFold is the policy Parse applies to folded lines.
+	ObsFold ObsFold
+
+	fields []field
+	// last is the index of the field the last parsed line was added to,
+	// plus one, so a folded line can be joined to it.
+	last int
+}
+
+type field struct {
+	name   string
+	values []string
+	// exact fields are written with name as given rather than canonical.
+	exact bool
+}
 
-func NewHeaders() Headers {
-	h := make(Headers)
-	return h
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 const crlf = "\r\n"
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	idx := bytes.Index(data, []byte(crlf))
 	if idx == -1 {
@@ -27,49 +64,213 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	line := data[:idx]
+	if line[0] == ' ' || line[0] == '\t' {
+		if err := h.unfold(line); err != nil {
+			return 0, false, err
+		}
+		return idx + len(crlf), false, nil
+	}
+
 	parts := bytes.SplitN(line, []byte(":"), 2)
 
 	if len(parts) < 2 {
-		return 0, false, fmt.Errorf("malformed header (missing colon): %q", string(line))
+		return 0, false, fmt.Errorf("%w: missing colon in %q", ErrMalformedHeader, string(line))
 	}
 
-	key := strings.ToLower(string(parts[0]))
+	key := string(parts[0])
 
 	if key != strings.TrimRight(key, " ") {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+		return 0, false, fmt.Errorf("%w: whitespace before colon in %q", ErrInvalidHeaderName, key)
 	}
 
-	if !isValid(key) {
-		return 0, false, fmt.Errorf("invalid use of characters %s", key)
+	if !IsToken(key) {
+		return 0, false, fmt.Errorf("%w: %q", ErrInvalidHeaderName, key)
 	}
 
-	key = strings.TrimSpace(key)
-	val := string(bytes.TrimSpace(parts[1]))
+	val := string(bytes.Trim(parts[1], " \t"))
 
-	if oldVal, ok := h[key]; ok {
-		joinedValue := oldVal + ", " + val
-		val = joinedValue
+	if err := h.Add(key, val); err != nil {
+		return 0, false, err
 	}
-
-	h[key] = val
+	h.last = h.index(key) + 1
 
 	return idx + len(crlf), false, nil
 
 }
 
-func (h Headers) Set(key string, val string) {
-	h[key] = val
+// unfold handles a line continuing the previous field line.
+func (h *Headers) unfold(line []byte) error {
+	if h.ObsFold != ReplaceObsFold {
+		return fmt.Errorf("%w: obsolete line folding in %q", ErrMalformedHeader, string(line))
+	}
+	if h.last == 0 {
+		return fmt.Errorf("%w: folded line without a field in %q", ErrMalformedHeader, string(line))
+	}
+	cont := string(bytes.Trim(line, " \t"))
+	if !ValidValue(cont) {
+		return fmt.Errorf("%w: %q", ErrInvalidHeaderValue, cont)
+	}
+	if cont != "" {
+		f := &h.fields[h.last-1]
+		f.values[len(f.values)-1] += " " + cont
+	}
+	return nil
+}
+
+func (h *Headers) index(key string) int {
+	if h == nil {
+		return -1
+	}
+	for i := range h.fields {
+		if strings.EqualFold(h.fields[i].name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *Headers) field(key string) *field {
+	if i := h.index(key); i != -1 {
+		return &h.fields[i]
+	}
+	return nil
+}
+
+// Add appends val to the values of the field key, adding the field if it
+// isn't there yet.
+func (h *Headers) Add(key string, val string) error {
+	if err := validField(key, val); err != nil {
+		return err
+	}
+	if f := h.field(key); f != nil {
+		f.values = append(f.values, val)
+		return nil
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{val}})
+	return nil
+}
+
+// Set replaces any values of the field key with val. Like Add it refuses,
+// and leaves h as it was, a name that isn't a token or a value holding
+// control characters such as CR or LF.
+func (h *Headers) Set(key string, val string) error {
+	return h.set(key, val, false)
+}
+
+// SetExact is Set for a field whose name must be written exactly as key
+// rather than in canonical form, for peers that care about case.
+func (h *Headers) SetExact(key string, val string) error {
+	return h.set(key, val, true)
+}
+
+func (h *Headers) set(key, val string, exact bool) error {
+	if err := validField(key, val); err != nil {
+		return err
+	}
+	if f := h.field(key); f != nil {
+		f.values = []string{val}
+		if exact {
+			f.name, f.exact = key, true
+		}
+		return nil
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{val}, exact: exact})
+	return nil
+}
+
+func validField(key, val string) error {
+	if !IsToken(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidHeaderName, key)
+	}
+	if !ValidValue(val) {
+		return fmt.Errorf("%w: %q", ErrInvalidHeaderValue, val)
+	}
+	return nil
+}
+
+// Get returns the values of the field key combined into one, separated by
+// ", ". Set-Cookie values can't be combined that way, so Get only returns
+// the first of them; use Values for the rest.
+func (h *Headers) Get(key string) (string, bool) {
+	f := h.field(key)
+	if f == nil {
+		return "", false
+	}
+	if strings.EqualFold(key, "Set-Cookie") {
+		return f.values[0], true
+	}
+	return strings.Join(f.values, ", "), true
 }
 
-func (h Headers) Get(key string) (string, error) {
-	val, ok := h[strings.ToLower(key)]
-	if ok {
-		return val, nil
+// Values returns the values of the field key in the order they were added,
+// one for each field line. The slice is owned by h.
+func (h *Headers) Values(key string) []string {
+	if f := h.field(key); f != nil {
+		return f.values
 	}
-	return "", fmt.Errorf("Key does not exist")
+	return nil
 }
 
-func isValid(s string) bool {
+func (h *Headers) Has(key string) bool {
+	return h.field(key) != nil
+}
+
+func (h *Headers) Del(key string) {
+	if i := h.index(key); i != -1 {
+		h.fields = append(h.fields[:i], h.fields[i+1:]...)
+		h.last = 0
+	}
+}
+
+// Len returns the number of distinct fields.
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All yields the field lines in order, as they are written on the wire: with
+// canonical names, and one line for each value.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			name := f.name
+			if !f.exact {
+				name = CanonicalName(name)
+			}
+			for _, val := range f.values {
+				if !yield(name, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// CanonicalName returns name with the first letter and every letter after a
+// hyphen upper-cased and the rest lower-cased, as in "Content-Type".
+func CanonicalName(name string) string {
+	b := []byte(name)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && c >= 'a' && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && c >= 'A' && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// IsToken reports whether s is a non-empty RFC 9110 token, the syntax of
+// field names and methods.
+func IsToken(s string) bool {
 	if len(s) < 1 {
 		return false
 	}
@@ -88,3 +289,14 @@ func isValid(s string) bool {
 	return true
 
 }
+
+// ValidValue reports whether s is a valid field value: visible characters,
+// obs-text, spaces and tabs, but no CR, LF, NUL or other control characters.
+func ValidValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,9 @@ package headers
 
 import (
 	"testing"
+	"time"
 
+	"github.com/httpfromtcp/internal/headers/sfv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -14,7 +16,9 @@ func TestHeaders(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	host, ok := headers.Get("host")
+	require.True(t, ok)
+	assert.Equal(t, "localhost:42069", host)
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -24,7 +28,9 @@ func TestHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "locaLHost:42069", headers["host"])
+	host, ok = headers.Get("Host")
+	require.True(t, ok)
+	assert.Equal(t, "locaLHost:42069", host)
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -44,6 +50,22 @@ func TestHeaders(t *testing.T) {
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
+	// Test: Missing colon
+	headers = NewHeaders()
+	data = []byte("Host localhost\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrMalformedHeader)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Whitespace before the colon
+	headers = NewHeaders()
+	data = []byte("Host : localhost:42069\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
 	// Test: Same header key
 	headers = NewHeaders()
 	data1 := []byte("Set-Person: lane-loves-go\r\nSet-Person: prime-loves-zig\r\nSet-Person: tj-loves-ocaml\r\n")
@@ -61,16 +83,21 @@ func TestHeaders(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, headers)
 
-	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
+	person, ok := headers.Get("set-person")
+	require.True(t, ok)
+	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", person)
 	assert.False(t, done)
 
 	// Test: Same header key
-	headers = map[string]string{"host": "localhost:8000"}
+	headers = NewHeaders()
+	headers.Set("host", "localhost:8000")
 	data = []byte("Host: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:8000, localhost:42069", headers["host"])
+	host, ok = headers.Get("host")
+	require.True(t, ok)
+	assert.Equal(t, "localhost:8000, localhost:42069", host)
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -80,7 +107,314 @@ func TestHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Empty(t, headers)
+	assert.Equal(t, 0, headers.Len())
 	assert.Equal(t, 2, n)
 	assert.True(t, done)
 }
+
+func TestHeaderOrder(t *testing.T) {
+	// Test: Fields keep the order they were set in
+	h := NewHeaders()
+	h.Set("content-type", "text/plain")
+	h.Set("x-request-id", "42")
+	h.Set("CONTENT-LENGTH", "5")
+	h.Set("Content-Type", "text/html")
+	var lines []string
+	for name, val := range h.All() {
+		lines = append(lines, name+": "+val)
+	}
+	assert.Equal(t, []string{"Content-Type: text/html", "X-Request-Id: 42", "Content-Length: 5"}, lines)
+
+	// Test: Exact casing
+	h.SetExact("x-REQUEST-id", "43")
+	lines = nil
+	for name, val := range h.All() {
+		lines = append(lines, name+": "+val)
+	}
+	assert.Equal(t, []string{"Content-Type: text/html", "x-REQUEST-id: 43", "Content-Length: 5"}, lines)
+
+	// Test: Deleting a field
+	h.Del("content-type")
+	assert.Equal(t, 2, h.Len())
+	assert.False(t, h.Has("Content-Type"))
+
+	// Test: Set-Cookie lines stay apart
+	h = NewHeaders()
+	_, _, err := h.Parse([]byte("Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\n"))
+	require.NoError(t, err)
+	_, _, err = h.Parse([]byte("Set-Cookie: b=2\r\n"))
+	require.NoError(t, err)
+	lines = nil
+	for name, val := range h.All() {
+		lines = append(lines, name+": "+val)
+	}
+	assert.Equal(t, []string{"Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "Set-Cookie: b=2"}, lines)
+
+	assert.Equal(t, "Content-Type", CanonicalName("content-TYPE"))
+	assert.Equal(t, "Www-Authenticate", CanonicalName("WWW-Authenticate"))
+	assert.Equal(t, "X-Content-Sha256", CanonicalName("x-content-sha256"))
+}
+
+func TestMultiValue(t *testing.T) {
+	// Test: Add keeps every value
+	h := NewHeaders()
+	h.Add("Vary", "Accept")
+	h.Add("Cache-Control", "no-cache")
+	h.Add("vary", "Accept-Encoding")
+	assert.Equal(t, []string{"Accept", "Accept-Encoding"}, h.Values("VARY"))
+	val, ok := h.Get("Vary")
+	require.True(t, ok)
+	assert.Equal(t, "Accept, Accept-Encoding", val)
+
+	// Test: Each value is its own line, in the position of the first
+	var lines []string
+	for name, val := range h.All() {
+		lines = append(lines, name+": "+val)
+	}
+	assert.Equal(t, []string{"Vary: Accept", "Vary: Accept-Encoding", "Cache-Control: no-cache"}, lines)
+
+	// Test: Set replaces all values
+	h.Set("vary", "*")
+	assert.Equal(t, []string{"*"}, h.Values("Vary"))
+
+	// Test: Missing field
+	val, ok = h.Get("Accept")
+	assert.False(t, ok)
+	assert.Equal(t, "", val)
+	assert.Nil(t, h.Values("Accept"))
+	assert.False(t, h.Has("Accept"))
+	assert.True(t, h.Has("cache-control"))
+	h.Del("Cache-Control")
+	assert.False(t, h.Has("cache-control"))
+
+	// Test: Parsed field lines stay apart
+	h = NewHeaders()
+	data := []byte("Set-Cookie: id=a3fWa; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: theme=dark\r\nVia: 1.1 a\r\nVia: 1.1 b\r\n\r\n")
+	for {
+		n, done, err := h.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []string{"id=a3fWa; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "theme=dark"}, h.Values("Set-Cookie"))
+	assert.Equal(t, []string{"1.1 a", "1.1 b"}, h.Values("via"))
+
+	// Test: Get doesn't combine cookies
+	val, ok = h.Get("Set-Cookie")
+	require.True(t, ok)
+	assert.Equal(t, "id=a3fWa; Expires=Wed, 21 Oct 2026 07:28:00 GMT", val)
+	val, _ = h.Get("Via")
+	assert.Equal(t, "1.1 a, 1.1 b", val)
+}
+
+func TestFieldValues(t *testing.T) {
+	// Test: Control characters in a value
+	for _, line := range []string{"X-Name: a\x00b\r\n", "X-Name: a\rb\r\n", "X-Name: a\nb\r\n", "X-Name: a\x7fb\r\n", "X-Name: a\x1bb\r\n"} {
+		h := NewHeaders()
+		n, _, err := h.Parse([]byte(line))
+		require.ErrorIs(t, err, ErrInvalidHeaderValue, line)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, 0, h.Len())
+	}
+
+	// Test: Tabs and obs-text are fine
+	h := NewHeaders()
+	_, _, err := h.Parse([]byte("X-Name:\tcaf\xe9\tau lait \r\n"))
+	require.NoError(t, err)
+	val, _ := h.Get("x-name")
+	assert.Equal(t, "caf\xe9\tau lait", val)
+
+	// Test: Set refuses header injection
+	h = NewHeaders()
+	h.Set("Location", "/home")
+	err = h.Set("Location", "/\r\nSet-Cookie: admin=1")
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+	err = h.Add("Location", "/\n")
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+	err = h.SetExact("X-Bad Name", "1")
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+	assert.Equal(t, []string{"/home"}, h.Values("Location"))
+	assert.Equal(t, 1, h.Len())
+
+	// Test: Obsolete line folding is rejected by default
+	h = NewHeaders()
+	_, _, err = h.Parse([]byte("X-Name: a\r\n"))
+	require.NoError(t, err)
+	n, _, err := h.Parse([]byte(" b\r\n"))
+	require.ErrorIs(t, err, ErrMalformedHeader)
+	assert.Equal(t, 0, n)
+
+	// Test: Or replaced with a space
+	h = &Headers{ObsFold: ReplaceObsFold}
+	for _, line := range []string{"Vary: Accept\r\n", "Vary: Accept-Encoding,\r\n", "\t Origin\r\n", "Accept: */*\r\n"} {
+		n, _, err := h.Parse([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.Equal(t, []string{"Accept", "Accept-Encoding, Origin"}, h.Values("Vary"))
+	assert.Equal(t, []string{"*/*"}, h.Values("Accept"))
+
+	// Test: A folded line needs a field to continue
+	h = &Headers{ObsFold: ReplaceObsFold}
+	_, _, err = h.Parse([]byte(" Host: localhost\r\n"))
+	require.ErrorIs(t, err, ErrMalformedHeader)
+}
+
+func TestTypedFields(t *testing.T) {
+	// Test: Content-Length
+	h := NewHeaders()
+	n, err := h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), n)
+	require.NoError(t, h.SetContentLength(42))
+	n, err = h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	h.Add("Content-Length", "42, 42")
+	n, err = h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	h.Set("Content-Length", "0000000000000000000000005")
+	n, err = h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	for _, val := range []string{"", "-1", "+5", "0x10", "4 2", "5, 6", "5,,5", "9223372036854775808"} {
+		h.Set("Content-Length", val)
+		_, err = h.ContentLength()
+		require.ErrorIs(t, err, ErrInvalidHeaderValue, val)
+	}
+
+	// Test: Content-Type
+	h = NewHeaders()
+	m, err := h.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "", m.Type)
+	h.Set("Content-Type", `Text/HTML; Charset="utf-8" ;; boundary=abc`)
+	m, err = h.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", m.Type)
+	assert.Equal(t, map[string]string{"charset": "utf-8", "boundary": "abc"}, m.Params)
+	require.NoError(t, h.SetContentType(MediaType{Type: "multipart/form-data", Params: map[string]string{"boundary": "a b", "charset": "utf-8"}}))
+	val, _ := h.Get("Content-Type")
+	assert.Equal(t, `multipart/form-data; boundary="a b"; charset=utf-8`, val)
+	for _, val := range []string{"text", "text/", "/html", "text/html; charset", `text/html; charset="utf-8`, "text/html; a=b c"} {
+		_, err = ParseMediaType(val)
+		require.ErrorIs(t, err, ErrInvalidHeaderValue, val)
+	}
+
+	// Test: Dates in all three formats
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, val := range []string{"Sun, 06 Nov 1994 08:49:37 GMT", "Sunday, 06-Nov-94 08:49:37 GMT", "Sun Nov  6 08:49:37 1994"} {
+		h = NewHeaders()
+		h.Set("Last-Modified", val)
+		got, err := h.LastModified()
+		require.NoError(t, err, val)
+		assert.True(t, want.Equal(got), val)
+	}
+	h = NewHeaders()
+	require.NoError(t, h.SetTime("Date", want.In(time.FixedZone("CET", 3600))))
+	require.Error(t, h.SetTime("Bad Key", want))
+	assert.False(t, h.Has("Bad Key"))
+	val, _ = h.Get("Date")
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", val)
+	got, err := h.IfModifiedSince()
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+	h.Set("If-Modified-Since", "yesterday")
+	_, err = h.IfModifiedSince()
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+
+	// Test: Connection options
+	h = NewHeaders()
+	h.Add("Connection", "Keep-Alive, Upgrade")
+	h.Add("Connection", " ,close")
+	assert.Equal(t, []string{"keep-alive", "upgrade", "close"}, h.Connection())
+	assert.True(t, h.HasConnectionOption("Close"))
+
+	// Test: Transfer-Encoding
+	h = NewHeaders()
+	h.Add("Transfer-Encoding", "gzip, Chunked")
+	codings, err := h.TransferEncoding()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gzip", "chunked"}, codings)
+	h.Set("Transfer-Encoding", "chunked;x=1")
+	_, err = h.TransferEncoding()
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+
+	// Test: Accept sorted by weight
+	h = NewHeaders()
+	h.Set("Accept", `text/*;q=0.3, text/html;q=0.7, text/html;level=1, text/html;level=2;q=0.4, */*;q=0.5, application/json; profile="a,b"`)
+	ranges, err := h.Accept()
+	require.NoError(t, err)
+	var types []string
+	var qs []float64
+	for _, r := range ranges {
+		types = append(types, r.Type)
+		qs = append(qs, r.Q)
+	}
+	assert.Equal(t, []string{"text/html", "application/json", "text/html", "*/*", "text/html", "text/*"}, types)
+	assert.Equal(t, []float64{1, 1, 0.7, 0.5, 0.4, 0.3}, qs)
+	assert.Equal(t, map[string]string{"level": "1"}, ranges[0].Params)
+	assert.Equal(t, map[string]string{"profile": "a,b"}, ranges[1].Params)
+	for _, val := range []string{"text/html;q=2", "text/html;q=1.5", "text/html;q=0.1234", "text/html;q=x"} {
+		h.Set("Accept", val)
+		_, err = h.Accept()
+		require.ErrorIs(t, err, ErrInvalidHeaderValue, val)
+	}
+}
+
+func TestStructuredFields(t *testing.T) {
+	// Test: Missing fields
+	h := NewHeaders()
+	item, err := h.Item("Priority")
+	require.NoError(t, err)
+	assert.Nil(t, item.Value)
+	dict, err := h.Dictionary("Priority")
+	require.NoError(t, err)
+	assert.Nil(t, dict)
+
+	// Test: Repeated lines are joined
+	h.Add("Priority", "u=1")
+	h.Add("Priority", "i")
+	dict, err = h.Dictionary("Priority")
+	require.NoError(t, err)
+	assert.Equal(t, sfv.Dictionary{
+		{Key: "u", Value: sfv.Item{Value: int64(1)}},
+		{Key: "i", Value: sfv.Item{Value: true}},
+	}, dict)
+
+	h.Add("Example-List", `"a";x=?0, (b c)`)
+	h.Add("Example-List", ":AQI=:")
+	list, err := h.List("Example-List")
+	require.NoError(t, err)
+	assert.Equal(t, sfv.List{
+		sfv.Item{Value: "a", Params: sfv.Params{{Key: "x", Value: false}}},
+		sfv.InnerList{Items: []sfv.Item{{Value: sfv.Token("b")}, {Value: sfv.Token("c")}}},
+		sfv.Item{Value: []byte{1, 2}},
+	}, list)
+
+	// Test: Parse errors
+	h.Set("Example-Item", "1, 2")
+	_, err = h.Item("Example-Item")
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+	require.ErrorIs(t, err, sfv.ErrSyntax)
+
+	// Test: Setters
+	h = NewHeaders()
+	require.NoError(t, h.SetItem("Example-Item", sfv.Item{Value: 2.5, Params: sfv.Params{{Key: "a", Value: true}}}))
+	val, _ := h.Get("Example-Item")
+	assert.Equal(t, "2.5;a", val)
+	require.NoError(t, h.SetDictionary("Cache-Status", sfv.Dictionary{{Key: "origin", Value: sfv.Item{Value: true, Params: sfv.Params{{Key: "hit", Value: true}, {Key: "ttl", Value: 30}}}}}))
+	val, _ = h.Get("Cache-Status")
+	assert.Equal(t, "origin;hit;ttl=30", val)
+	require.NoError(t, h.SetList("Example-List", sfv.List{sfv.Item{Value: sfv.Token("gzip")}, sfv.Item{Value: sfv.Token("br")}}))
+	val, _ = h.Get("Example-List")
+	assert.Equal(t, "gzip, br", val)
+	require.NoError(t, h.SetList("Example-List", nil))
+	assert.False(t, h.Has("Example-List"))
+	require.ErrorIs(t, h.SetItem("Example-Item", sfv.Item{Value: "caf\u00e9"}), sfv.ErrInvalidValue)
+	val, _ = h.Get("Example-Item")
+	assert.Equal(t, "2.5;a", val)
+}
@@ -0,0 +1,419 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ParseItem parses a field value holding an Item. Field lines that were
+// repeated should be joined with ", " first.
+func ParseItem(s string) (Item, error) {
+	p := parser{s: s}
+	p.skipSP()
+	item, err := p.item()
+	if err != nil {
+		return Item{}, err
+	}
+	return item, p.end()
+}
+
+// ParseList parses a field value holding a List. An empty value is an
+// empty List.
+func ParseList(s string) (List, error) {
+	p := parser{s: s}
+	p.skipSP()
+	var list List
+	for !p.empty() {
+		m, err := p.member()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+		if done, err := p.next(); done || err != nil {
+			return list, err
+		}
+	}
+	return list, p.end()
+}
+
+// ParseDictionary parses a field value holding a Dictionary. An empty value
+// is an empty Dictionary. A repeated key keeps its first position and takes
+// its last value.
+func ParseDictionary(s string) (Dictionary, error) {
+	p := parser{s: s}
+	p.skipSP()
+	var dict Dictionary
+	for !p.empty() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		var m Member
+		if p.peek() == '=' {
+			p.i++
+			if m, err = p.member(); err != nil {
+				return nil, err
+			}
+		} else {
+			// a bare key is a true Boolean
+			params, err := p.params()
+			if err != nil {
+				return nil, err
+			}
+			m = Item{Value: true, Params: params}
+		}
+		dict = dict.set(key, m)
+
+		if done, err := p.next(); done || err != nil {
+			return dict, err
+		}
+	}
+	return dict, p.end()
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) empty() bool {
+	return p.i >= len(p.s)
+}
+
+// peek returns the next byte, or 0 at the end.
+func (p *parser) peek() byte {
+	if p.empty() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *parser) skipSP() {
+	for p.peek() == ' ' {
+		p.i++
+	}
+}
+
+func (p *parser) skipOWS() {
+	for c := p.peek(); c == ' ' || c == '\t'; c = p.peek() {
+		p.i++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrSyntax, fmt.Sprintf(format, args...), p.i)
+}
+
+// end fails unless only spaces are left.
+func (p *parser) end() error {
+	p.skipSP()
+	if !p.empty() {
+		return p.errorf("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+// next moves past the comma between members of a List or Dictionary and
+// reports whether the last member has been parsed.
+func (p *parser) next() (bool, error) {
+	p.skipOWS()
+	if p.empty() {
+		return true, nil
+	}
+	if p.peek() != ',' {
+		return false, p.errorf("expected comma, got %q", p.peek())
+	}
+	p.i++
+	p.skipOWS()
+	if p.empty() {
+		return false, p.errorf("trailing comma")
+	}
+	return false, nil
+}
+
+func (p *parser) member() (Member, error) {
+	if p.peek() == '(' {
+		return p.innerList()
+	}
+	return p.item()
+}
+
+func (p *parser) innerList() (InnerList, error) {
+	p.i++ // (
+	var items []Item
+	for !p.empty() {
+		p.skipSP()
+		if p.peek() == ')' {
+			p.i++
+			params, err := p.params()
+			return InnerList{Items: items, Params: params}, err
+		}
+		item, err := p.item()
+		if err != nil {
+			return InnerList{}, err
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return InnerList{}, p.errorf("expected space or ) in inner list, got %q", c)
+		}
+	}
+	return InnerList{}, p.errorf("unterminated inner list")
+}
+
+func (p *parser) item() (Item, error) {
+	v, err := p.bareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.params()
+	return Item{Value: v, Params: params}, err
+}
+
+func (p *parser) params() (Params, error) {
+	var params Params
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var v any = true
+		if p.peek() == '=' {
+			p.i++
+			if v, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = params.set(key, v)
+	}
+	return params, nil
+}
+
+func (p *parser) key() (string, error) {
+	if c := p.peek(); !isLCAlpha(c) && c != '*' {
+		return "", p.errorf("invalid key start %q", c)
+	}
+	start := p.i
+	for !p.empty() && isKeyChar(p.peek()) {
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *parser) bareItem() (any, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	case c == '*' || isAlpha(c):
+		return p.token(), nil
+	case c == ':':
+		return p.byteSequence()
+	case c == '?':
+		return p.boolean()
+	case c == '@':
+		return p.date()
+	case c == '%':
+		return p.displayString()
+	default:
+		return nil, p.errorf("unexpected %q at the start of an item", c)
+	}
+}
+
+// number returns an int64 for an Integer or a float64 for a Decimal.
+func (p *parser) number() (any, error) {
+	start := p.i
+	if p.peek() == '-' {
+		p.i++
+	}
+	if !isDigit(p.peek()) {
+		return nil, p.errorf("expected digit")
+	}
+
+	digits, dot := 0, -1
+	for ; !p.empty(); p.i++ {
+		c := p.peek()
+		if isDigit(c) {
+			digits++
+		} else if c == '.' && dot == -1 {
+			if digits > 12 {
+				return nil, p.errorf("integer part of decimal too long")
+			}
+			dot = digits
+		} else {
+			break
+		}
+		if dot == -1 && digits > 15 {
+			return nil, p.errorf("integer too long")
+		}
+		if dot != -1 && digits+1 > 16 {
+			return nil, p.errorf("decimal too long")
+		}
+	}
+
+	num := p.s[start:p.i]
+	if dot == -1 {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %q", num)
+		}
+		return n, nil
+	}
+	if frac := digits - dot; frac == 0 || frac > 3 {
+		return nil, p.errorf("invalid decimal %q", num)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, p.errorf("invalid decimal %q", num)
+	}
+	return f, nil
+}
+
+func (p *parser) string() (string, error) {
+	p.i++ // "
+	var b strings.Builder
+	for !p.empty() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if p.empty() {
+				return "", p.errorf("unterminated string")
+			}
+			next := p.s[p.i]
+			p.i++
+			if next != '"' && next != '\\' {
+				return "", p.errorf("invalid escape %q", next)
+			}
+			b.WriteByte(next)
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid string character %q", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) token() Token {
+	start := p.i
+	p.i++
+	for !p.empty() && (isTChar(p.peek()) || p.peek() == ':' || p.peek() == '/') {
+		p.i++
+	}
+	return Token(p.s[start:p.i])
+}
+
+func (p *parser) byteSequence() ([]byte, error) {
+	p.i++ // :
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end == -1 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	b64 := p.s[p.i : p.i+end]
+	p.i += end + 1
+	for i := 0; i < len(b64); i++ {
+		if c := b64[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+			return nil, p.errorf("invalid base64 character %q", c)
+		}
+	}
+	// padding is optional on the way in
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(b64, "="))
+	if err != nil {
+		return nil, p.errorf("invalid base64 %q", b64)
+	}
+	return data, nil
+}
+
+func (p *parser) boolean() (bool, error) {
+	p.i++ // ?
+	switch p.peek() {
+	case '1':
+		p.i++
+		return true, nil
+	case '0':
+		p.i++
+		return false, nil
+	default:
+		return false, p.errorf("invalid boolean")
+	}
+}
+
+func (p *parser) date() (time.Time, error) {
+	p.i++ // @
+	n, err := p.number()
+	if err != nil {
+		return time.Time{}, err
+	}
+	secs, ok := n.(int64)
+	if !ok {
+		return time.Time{}, p.errorf("date is not an integer")
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+func (p *parser) displayString() (DisplayString, error) {
+	p.i++ // %
+	if p.peek() != '"' {
+		return "", p.errorf("expected \" after %%")
+	}
+	p.i++
+
+	var b []byte
+	for !p.empty() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid display string character %q", c)
+		case c == '%':
+			if p.i+2 > len(p.s) || !isLCHex(p.s[p.i]) || !isLCHex(p.s[p.i+1]) {
+				return "", p.errorf("invalid percent-encoding")
+			}
+			n, _ := strconv.ParseUint(p.s[p.i:p.i+2], 16, 8)
+			b = append(b, byte(n))
+			p.i += 2
+		case c == '"':
+			if !utf8.Valid(b) {
+				return "", p.errorf("display string is not UTF-8")
+			}
+			return DisplayString(b), nil
+		default:
+			b = append(b, c)
+		}
+	}
+	return "", p.errorf("unterminated display string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLCAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isAlpha(c byte) bool {
+	return isLCAlpha(c) || c >= 'A' && c <= 'Z'
+}
+
+func isLCHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f'
+}
+
+func isKeyChar(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+func isTChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
@@ -0,0 +1,256 @@
+package sfv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// the largest magnitude an Integer may have, 15 digits
+const maxInteger = 999_999_999_999_999
+
+// SerializeItem returns the field value for item.
+func SerializeItem(item Item) (string, error) {
+	var b strings.Builder
+	if err := writeItem(&b, item); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SerializeList returns the field value for list. An empty List serializes
+// to "", in which case the field should not be sent at all.
+func SerializeList(list List) (string, error) {
+	var b strings.Builder
+	for i, m := range list {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeMember(&b, m); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// SerializeDictionary returns the field value for dict. An empty Dictionary
+// serializes to "", in which case the field should not be sent at all.
+func SerializeDictionary(dict Dictionary) (string, error) {
+	var b strings.Builder
+	for i, m := range dict {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeKey(&b, m.Key); err != nil {
+			return "", err
+		}
+		// a true Boolean is left implied
+		if item, ok := m.Value.(Item); ok && item.Value == true {
+			if err := writeParams(&b, item.Params); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeMember(&b, m.Value); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func writeMember(b *strings.Builder, m Member) error {
+	switch m := m.(type) {
+	case Item:
+		return writeItem(b, m)
+	case InnerList:
+		return writeInnerList(b, m)
+	default:
+		return fmt.Errorf("%w: member %T", ErrInvalidValue, m)
+	}
+}
+
+func writeInnerList(b *strings.Builder, list InnerList) error {
+	b.WriteByte('(')
+	for i, item := range list.Items {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if err := writeItem(b, item); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(')')
+	return writeParams(b, list.Params)
+}
+
+func writeItem(b *strings.Builder, item Item) error {
+	if err := writeBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return writeParams(b, item.Params)
+}
+
+func writeParams(b *strings.Builder, params Params) error {
+	for _, param := range params {
+		b.WriteByte(';')
+		if err := writeKey(b, param.Key); err != nil {
+			return err
+		}
+		if param.Value == true {
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeBareItem(b, param.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(b *strings.Builder, key string) error {
+	if key == "" || !isLCAlpha(key[0]) && key[0] != '*' {
+		return fmt.Errorf("%w: key %q", ErrInvalidValue, key)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("%w: key %q", ErrInvalidValue, key)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+func writeBareItem(b *strings.Builder, v any) error {
+	switch v := v.(type) {
+	case int:
+		return writeInteger(b, int64(v))
+	case int64:
+		return writeInteger(b, v)
+	case float64:
+		return writeDecimal(b, v)
+	case string:
+		return writeString(b, v)
+	case Token:
+		return writeToken(b, v)
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+		return nil
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+		return nil
+	case time.Time:
+		b.WriteByte('@')
+		return writeInteger(b, v.Unix())
+	case DisplayString:
+		return writeDisplayString(b, v)
+	default:
+		return fmt.Errorf("%w: bare item %T", ErrInvalidValue, v)
+	}
+}
+
+func writeInteger(b *strings.Builder, n int64) error {
+	if n > maxInteger || n < -maxInteger {
+		return fmt.Errorf("%w: integer %d out of range", ErrInvalidValue, n)
+	}
+	b.WriteString(strconv.FormatInt(n, 10))
+	return nil
+}
+
+// writeDecimal writes f rounded to three decimal places, ties to even. The
+// rounding is done on the shortest decimal form of f, so 0.0015 rounds as
+// the decimal it was written as rather than the binary fraction below it.
+func writeDecimal(b *strings.Builder, f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("%w: decimal %v", ErrInvalidValue, f)
+	}
+	whole, frac, _ := strings.Cut(strconv.FormatFloat(math.Abs(f), 'f', -1, 64), ".")
+	if len(frac) > 3 {
+		rest := frac[3:]
+		up := rest[0] > '5' || rest[0] == '5' && (strings.TrimRight(rest[1:], "0") != "" || (frac[2]-'0')%2 == 1)
+		frac = frac[:3]
+		if up {
+			digits := []byte(whole + frac)
+			i := len(digits) - 1
+			for ; i >= 0 && digits[i] == '9'; i-- {
+				digits[i] = '0'
+			}
+			if i < 0 {
+				digits = append([]byte{'1'}, digits...)
+			} else {
+				digits[i]++
+			}
+			whole, frac = string(digits[:len(digits)-3]), string(digits[len(digits)-3:])
+		}
+	}
+	if len(strings.TrimLeft(whole, "0")) > 12 {
+		return fmt.Errorf("%w: decimal %v out of range", ErrInvalidValue, f)
+	}
+	if frac = strings.TrimRight(frac, "0"); frac == "" {
+		frac = "0"
+	}
+	if f < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(whole + "." + frac)
+	return nil
+}
+
+func writeString(b *strings.Builder, s string) error {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return fmt.Errorf("%w: string %q has a character outside printable ASCII", ErrInvalidValue, s)
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return nil
+}
+
+func writeToken(b *strings.Builder, t Token) error {
+	if t == "" || !isAlpha(t[0]) && t[0] != '*' {
+		return fmt.Errorf("%w: token %q", ErrInvalidValue, t)
+	}
+	for i := 1; i < len(t); i++ {
+		if c := t[i]; !isTChar(c) && c != ':' && c != '/' {
+			return fmt.Errorf("%w: token %q", ErrInvalidValue, t)
+		}
+	}
+	b.WriteString(string(t))
+	return nil
+}
+
+func writeDisplayString(b *strings.Builder, s DisplayString) error {
+	if !utf8.ValidString(string(s)) {
+		return fmt.Errorf("%w: display string %q is not UTF-8", ErrInvalidValue, s)
+	}
+	const hex = "0123456789abcdef"
+	b.WriteString(`%"`)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' || c == '"' || c < 0x20 || c > 0x7e {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package sfv parses and serializes Structured Field Values, RFC 9651 (which
+// obsoletes RFC 8941).
+package sfv
+
+import (
+	"errors"
+)
+
+var (
+	// ErrSyntax is wrapped by every parse error.
+	ErrSyntax = errors.New("invalid structured field")
+	// ErrInvalidValue is wrapped by every serialization error.
+	ErrInvalidValue = errors.New("value can't be serialized as a structured field")
+)
+
+// Bare item values are held as:
+//
+//	Integer        int64
+//	Decimal        float64
+//	String         string
+//	Token          Token
+//	Byte Sequence  []byte
+//	Boolean        bool
+//	Date           time.Time
+//	Display String DisplayString
+//
+// Serializing also accepts an int for an Integer.
+
+// Token is a Token bare item, a short textual word such as "gzip".
+type Token string
+
+// DisplayString is a Display String bare item, which unlike String may hold
+// any Unicode text.
+type DisplayString string
+
+// Param is a single parameter on an Item or InnerList.
+type Param struct {
+	Key   string
+	Value any
+}
+
+// Params is an ordered set of parameters. Keys are unique.
+type Params []Param
+
+// Get returns the value of the parameter key.
+func (p Params) Get(key string) (any, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set overwrites key in place if it is already there, otherwise it adds it
+// to the end.
+func (p Params) set(key string, value any) Params {
+	for i := range p {
+		if p[i].Key == key {
+			p[i].Value = value
+			return p
+		}
+	}
+	return append(p, Param{Key: key, Value: value})
+}
+
+// Member is a member of a List or Dictionary: an Item or an InnerList.
+type Member interface {
+	member()
+}
+
+// Item is a bare item with parameters.
+type Item struct {
+	Value  any
+	Params Params
+}
+
+// InnerList is a parenthesized list of Items with parameters.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+func (Item) member()      {}
+func (InnerList) member() {}
+
+type List []Member
+
+// DictMember is a single key and its value in a Dictionary.
+type DictMember struct {
+	Key   string
+	Value Member
+}
+
+// Dictionary is an ordered map of keys to members. Keys are unique.
+type Dictionary []DictMember
+
+// Get returns the member under key.
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (d Dictionary) set(key string, value Member) Dictionary {
+	for i := range d {
+		if d[i].Key == key {
+			d[i].Value = value
+			return d
+		}
+	}
+	return append(d, DictMember{Key: key, Value: value})
+}
@@ -0,0 +1,249 @@
+package sfv
+
+//go:generate go run testdata/generate.go
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vector is a test case in the format of the structured field tests, see
+// testdata/README.md.
+type vector struct {
+	Name       string   `json:"name"`
+	Raw        []string `json:"raw"`
+	HeaderType string   `json:"header_type"`
+	Expected   any      `json:"expected"`
+	MustFail   bool     `json:"must_fail"`
+	CanFail    bool     `json:"can_fail"`
+	Canonical  []string `json:"canonical"`
+}
+
+// skipped lists the vectors the package doesn't support, as file/name, with
+// the reason. Upstream files are checked in whole, so cases are skipped here
+// rather than removed from them.
+var skipped = map[string]string{}
+
+func loadVectors(t *testing.T, pattern string) map[string][]vector {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	vectors := map[string][]vector{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		var vs []vector
+		require.NoError(t, dec.Decode(&vs), file)
+		f.Close()
+		vectors[filepath.Base(file)] = vs
+	}
+	return vectors
+}
+
+func TestVectors(t *testing.T) {
+	for file, vs := range loadVectors(t, "testdata/*.json") {
+		for _, v := range vs {
+			t.Run(file+"/"+v.Name, func(t *testing.T) {
+				if why, ok := skipped[file+"/"+v.Name]; ok {
+					t.Skip(why)
+				}
+				raw := strings.Join(v.Raw, ", ")
+				got, err := parse(v.HeaderType, raw)
+				if v.MustFail {
+					assert.ErrorIs(t, err, ErrSyntax)
+					return
+				}
+				if v.CanFail && err != nil {
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, toValue(t, v.HeaderType, v.Expected), got)
+
+				want := raw
+				if v.Canonical != nil {
+					want = strings.Join(v.Canonical, ", ")
+				}
+				s, err := serialize(got)
+				require.NoError(t, err)
+				assert.Equal(t, want, s)
+			})
+		}
+	}
+}
+
+func TestSerializationVectors(t *testing.T) {
+	for file, vs := range loadVectors(t, "testdata/serialisation-tests/*.json") {
+		for _, v := range vs {
+			t.Run(file+"/"+v.Name, func(t *testing.T) {
+				if why, ok := skipped["serialisation-tests/"+file+"/"+v.Name]; ok {
+					t.Skip(why)
+				}
+				s, err := serialize(toValue(t, v.HeaderType, v.Expected))
+				if v.MustFail {
+					assert.ErrorIs(t, err, ErrInvalidValue)
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, strings.Join(v.Canonical, ", "), s)
+			})
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	item, err := ParseItem(`text/html;q=0.5;charset="utf-8";q=1`)
+	require.NoError(t, err)
+	assert.Equal(t, Token("text/html"), item.Value)
+	// a repeated parameter keeps its place and takes the last value
+	assert.Equal(t, Params{{"q", int64(1)}, {"charset", "utf-8"}}, item.Params)
+	q, ok := item.Params.Get("q")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), q)
+	_, ok = item.Params.Get("level")
+	assert.False(t, ok)
+
+	dict, err := ParseDictionary("a=1, b, c=(x y);z")
+	require.NoError(t, err)
+	b, ok := dict.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, Item{Value: true}, b)
+	_, ok = dict.Get("d")
+	assert.False(t, ok)
+
+	s, err := SerializeItem(Item{Value: 5, Params: Params{{"a", true}, {"b", false}}})
+	require.NoError(t, err)
+	assert.Equal(t, "5;a;b=?0", s)
+
+	_, err = SerializeItem(Item{Value: 1.5, Params: Params{{"Upper", true}}})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	_, err = SerializeItem(Item{Value: struct{}{}})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	_, err = SerializeItem(Item{Value: DisplayString("\xff")})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func parse(headerType, raw string) (any, error) {
+	switch headerType {
+	case "item":
+		return ParseItem(raw)
+	case "list":
+		return ParseList(raw)
+	case "dictionary":
+		return ParseDictionary(raw)
+	default:
+		return nil, fmt.Errorf("unknown header type %q", headerType)
+	}
+}
+
+func serialize(v any) (string, error) {
+	switch v := v.(type) {
+	case Item:
+		return SerializeItem(v)
+	case List:
+		return SerializeList(v)
+	case Dictionary:
+		return SerializeDictionary(v)
+	default:
+		return "", fmt.Errorf("unknown value %T", v)
+	}
+}
+
+// toValue converts the JSON form of an expected value to the Go one.
+func toValue(t *testing.T, headerType string, expected any) any {
+	t.Helper()
+	switch headerType {
+	case "item":
+		return toItem(t, expected)
+	case "list":
+		var list List
+		for _, m := range expected.([]any) {
+			list = append(list, toMember(t, m))
+		}
+		return list
+	case "dictionary":
+		var dict Dictionary
+		for _, m := range expected.([]any) {
+			kv := m.([]any)
+			dict = append(dict, DictMember{Key: kv[0].(string), Value: toMember(t, kv[1])})
+		}
+		return dict
+	default:
+		t.Fatalf("unknown header type %q", headerType)
+		return nil
+	}
+}
+
+func toMember(t *testing.T, v any) Member {
+	pair := v.([]any)
+	items, ok := pair[0].([]any)
+	if !ok {
+		return toItem(t, v)
+	}
+	var list InnerList
+	for _, item := range items {
+		list.Items = append(list.Items, toItem(t, item))
+	}
+	list.Params = toParams(t, pair[1])
+	return list
+}
+
+func toItem(t *testing.T, v any) Item {
+	pair := v.([]any)
+	return Item{Value: toBareItem(t, pair[0]), Params: toParams(t, pair[1])}
+}
+
+func toParams(t *testing.T, v any) Params {
+	var params Params
+	for _, p := range v.([]any) {
+		kv := p.([]any)
+		params = append(params, Param{Key: kv[0].(string), Value: toBareItem(t, kv[1])})
+	}
+	return params
+}
+
+func toBareItem(t *testing.T, v any) any {
+	t.Helper()
+	switch v := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			n, err := v.Int64()
+			require.NoError(t, err)
+			return n
+		}
+		f, err := v.Float64()
+		require.NoError(t, err)
+		return f
+	case string, bool:
+		return v
+	case map[string]any:
+		switch v["__type"] {
+		case "token":
+			return Token(v["value"].(string))
+		case "displaystring":
+			return DisplayString(v["value"].(string))
+		case "binary":
+			b, err := base32.StdEncoding.DecodeString(v["value"].(string))
+			require.NoError(t, err)
+			return b
+		case "date":
+			secs, err := v["value"].(json.Number).Int64()
+			require.NoError(t, err)
+			return time.Unix(secs, 0).UTC()
+		}
+	}
+	t.Fatalf("unknown bare item %v", v)
+	return nil
+}
@@ -0,0 +1,396 @@
+//go:build ignore
+
+// generate writes the generated test vectors: large.json and the
+// *-generated.json files, here and in serialisation-tests. It follows the
+// generator of the upstream suite, deciding each expectation from the RFC
+// 9651 grammar rather than from this package.
+//
+// Run it from the sfv directory with go generate.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type vector struct {
+	Name       string   `json:"name"`
+	Raw        []string `json:"raw,omitempty"`
+	HeaderType string   `json:"header_type"`
+	Expected   any      `json:"expected,omitempty"`
+	MustFail   bool     `json:"must_fail,omitempty"`
+	Canonical  []string `json:"canonical,omitempty"`
+}
+
+type special struct {
+	Type  string `json:"__type"`
+	Value any    `json:"value"`
+}
+
+func token(s string) special { return special{"token", s} }
+
+// item and param build the JSON forms of expected values.
+func item(v any, params ...any) []any {
+	if params == nil {
+		params = []any{}
+	}
+	return []any{v, params}
+}
+
+func param(key string, v any) []any { return []any{key, v} }
+
+const (
+	lcalpha  = "abcdefghijklmnopqrstuvwxyz"
+	alpha    = lcalpha + "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits   = "0123456789"
+	keyChars = lcalpha + digits + "_-.*"
+	keyStart = lcalpha + "*"
+	// tchar, plus the ":" and "/" sf-token allows
+	tokenChars = alpha + digits + "!#$%&'*+-.^_`|~:/"
+	tokenStart = alpha + "*"
+)
+
+func main() {
+	write("key-generated.json", keyTests())
+	write("token-generated.json", tokenTests())
+	write("string-generated.json", stringTests())
+	write("number-generated.json", numberTests())
+	write("large.json", largeTests())
+	write("serialisation-tests/key-generated.json", keySerialisationTests())
+	write("serialisation-tests/token-generated.json", tokenSerialisationTests())
+	write("serialisation-tests/string-generated.json", stringSerialisationTests())
+}
+
+func name(c byte, format string) string {
+	return fmt.Sprintf("0x%02x "+format, c)
+}
+
+func keyTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "in dictionary key"), HeaderType: "dictionary", Raw: []string{"a" + string(c) + "a=1"}}
+		switch {
+		case strings.IndexByte(keyChars, c) != -1:
+			v.Expected = []any{[]any{"a" + string(c) + "a", item(1)}}
+		case c == ',':
+			// a, then a=1 overriding it
+			v.Expected = []any{[]any{"a", item(1)}}
+			v.Canonical = []string{"a=1"}
+		case c == ';':
+			v.Expected = []any{[]any{"a", item(true, param("a", 1))}}
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "starting a dictionary key"), HeaderType: "dictionary", Raw: []string{string(c) + "a=1"}}
+		switch {
+		case strings.IndexByte(keyStart, c) != -1:
+			v.Expected = []any{[]any{string(c) + "a", item(1)}}
+		case c == ' ':
+			v.Expected = []any{[]any{"a", item(1)}}
+			v.Canonical = []string{"a=1"}
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "in parameterised list key"), HeaderType: "list", Raw: []string{"foo; a" + string(c) + "a=1"}}
+		switch {
+		case strings.IndexByte(keyChars, c) != -1:
+			v.Expected = []any{item(token("foo"), param("a"+string(c)+"a", 1))}
+			v.Canonical = []string{"foo;a" + string(c) + "a=1"}
+		case c == ';':
+			// a, then a=1 overriding it
+			v.Expected = []any{item(token("foo"), param("a", 1))}
+			v.Canonical = []string{"foo;a=1"}
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "starting a parameterised list key"), HeaderType: "list", Raw: []string{"foo;" + string(c) + "a=1"}}
+		switch {
+		case strings.IndexByte(keyStart, c) != -1:
+			v.Expected = []any{item(token("foo"), param(string(c)+"a", 1))}
+		case c == ' ':
+			v.Expected = []any{item(token("foo"), param("a", 1))}
+			v.Canonical = []string{"foo;a=1"}
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func keySerialisationTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(keyChars, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "in dictionary key"),
+				HeaderType: "dictionary",
+				Expected:   []any{[]any{"a" + string(c) + "a", item(1)}},
+				MustFail:   true,
+			})
+		}
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(keyStart, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "starting a dictionary key"),
+				HeaderType: "dictionary",
+				Expected:   []any{[]any{string(c) + "a", item(1)}},
+				MustFail:   true,
+			})
+		}
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(keyChars, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "in parameterised list key"),
+				HeaderType: "list",
+				Expected:   []any{item(token("foo"), param("a"+string(c)+"a", 1))},
+				MustFail:   true,
+			})
+		}
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(keyStart, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "starting a parameterised list key"),
+				HeaderType: "list",
+				Expected:   []any{item(token("foo"), param(string(c)+"a", 1))},
+				MustFail:   true,
+			})
+		}
+	}
+	return vs
+}
+
+func tokenTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "in token"), HeaderType: "item", Raw: []string{"a" + string(c) + "a"}}
+		switch {
+		case strings.IndexByte(tokenChars, c) != -1:
+			v.Expected = item(token("a" + string(c) + "a"))
+		case c == ';':
+			v.Expected = item(token("a"), param("a", true))
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "starting a token"), HeaderType: "item", Raw: []string{string(c) + "a"}}
+		switch {
+		case strings.IndexByte(tokenStart, c) != -1:
+			v.Expected = item(token(string(c) + "a"))
+		case c == ' ':
+			v.Expected = item(token("a"))
+			v.Canonical = []string{"a"}
+		default:
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func tokenSerialisationTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(tokenChars, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "in token"),
+				HeaderType: "item",
+				Expected:   item(token("a" + string(c) + "a")),
+				MustFail:   true,
+			})
+		}
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		if strings.IndexByte(tokenStart, c) == -1 {
+			vs = append(vs, vector{
+				Name:       name(c, "starting a token"),
+				HeaderType: "item",
+				Expected:   item(token(string(c) + "a")),
+				MustFail:   true,
+			})
+		}
+	}
+	return vs
+}
+
+func printable(c byte) bool {
+	return c >= 0x20 && c < 0x7f
+}
+
+func stringTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: name(c, "in string"), HeaderType: "item", Raw: []string{`" ` + string(c) + ` "`}}
+		if printable(c) && c != '"' && c != '\\' {
+			v.Expected = item(" " + string(c) + " ")
+		} else {
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	for c := byte(0); c < 0x7f; c++ {
+		v := vector{Name: fmt.Sprintf("Escaped 0x%02x in string", c), HeaderType: "item", Raw: []string{`"\` + string(c) + `"`}}
+		if c == '"' || c == '\\' {
+			v.Expected = item(string(c))
+		} else {
+			v.MustFail = true
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func stringSerialisationTests() []vector {
+	var vs []vector
+	for c := byte(0); c < 0x7f; c++ {
+		if !printable(c) {
+			vs = append(vs, vector{
+				Name:       name(c, "in string"),
+				HeaderType: "item",
+				Expected:   item(" " + string(c) + " "),
+				MustFail:   true,
+			})
+		}
+	}
+	return vs
+}
+
+func numberTests() []vector {
+	var vs []vector
+	for i := 1; i <= 16; i++ {
+		for _, n := range []struct {
+			name, digit, canonical string
+		}{
+			{"%d digits of zero", "0", "0"},
+			{"%d digit small integer", "1", ""},
+			{"%d digit large integer", "9", ""},
+		} {
+			raw := strings.Repeat(n.digit, i)
+			v := vector{Name: fmt.Sprintf(n.name, i), HeaderType: "item", Raw: []string{raw}}
+			switch {
+			case i > 15:
+				v.MustFail = true
+			case n.canonical != "":
+				v.Expected = item(json.Number(n.canonical))
+				v.Canonical = []string{n.canonical}
+			default:
+				v.Expected = item(json.Number(raw))
+			}
+			vs = append(vs, v)
+		}
+	}
+	for i := 1; i <= 13; i++ {
+		for j := 1; j <= 4; j++ {
+			for _, n := range []struct {
+				name, digit, canonical string
+			}{
+				{"%d digit 0, %d fractional decimal", "0", "0.0"},
+				{"%d digit %d fractional small decimal", "1", ""},
+				{"%d digit %d fractional large decimal", "9", ""},
+			} {
+				raw := strings.Repeat(n.digit, i) + "." + strings.Repeat(n.digit, j)
+				v := vector{Name: fmt.Sprintf(n.name, i, j), HeaderType: "item", Raw: []string{raw}}
+				switch {
+				case i > 12 || j > 3:
+					v.MustFail = true
+				case n.canonical != "":
+					v.Expected = item(json.Number(n.canonical))
+					v.Canonical = []string{n.canonical}
+				default:
+					v.Expected = item(json.Number(raw))
+				}
+				vs = append(vs, v)
+			}
+		}
+	}
+	return vs
+}
+
+// largeTests checks the minimum sizes RFC 9651 section 3 asks parsers to
+// support.
+func largeTests() []vector {
+	var vs []vector
+
+	var raw []string
+	var dict []any
+	for i := 0; i < 1024; i++ {
+		key := fmt.Sprintf("a%d", i)
+		raw = append(raw, key+"=1")
+		dict = append(dict, []any{key, item(1)})
+	}
+	vs = append(vs, vector{Name: "large dictionary", HeaderType: "dictionary", Raw: []string{strings.Join(raw, ", ")}, Expected: dict})
+
+	key := strings.Repeat("a", 64)
+	vs = append(vs, vector{Name: "large dictionary key", HeaderType: "dictionary", Raw: []string{key + "=1"}, Expected: []any{[]any{key, item(1)}}})
+
+	raw = nil
+	var list []any
+	for i := 0; i < 1024; i++ {
+		tok := fmt.Sprintf("a%d", i)
+		raw = append(raw, tok)
+		list = append(list, item(token(tok)))
+	}
+	vs = append(vs, vector{Name: "large list", HeaderType: "list", Raw: []string{strings.Join(raw, ", ")}, Expected: list})
+
+	raw = nil
+	var inner []any
+	for i := 0; i < 256; i++ {
+		raw = append(raw, "1")
+		inner = append(inner, item(1))
+	}
+	vs = append(vs, vector{Name: "large inner list", HeaderType: "list", Raw: []string{"(" + strings.Join(raw, " ") + ")"}, Expected: []any{[]any{inner, []any{}}}})
+
+	raw = nil
+	var params []any
+	for i := 0; i < 256; i++ {
+		k := fmt.Sprintf("a%d", i)
+		raw = append(raw, k+"=1")
+		params = append(params, param(k, 1))
+	}
+	vs = append(vs, vector{Name: "large params", HeaderType: "list", Raw: []string{"foo;" + strings.Join(raw, ";")}, Expected: []any{item(token("foo"), params...)}})
+
+	vs = append(vs, vector{Name: "large param key", HeaderType: "list", Raw: []string{"foo;" + key + "=1"}, Expected: []any{item(token("foo"), param(key, 1))}})
+
+	s := strings.Repeat("a", 1024)
+	vs = append(vs, vector{Name: "large string", HeaderType: "item", Raw: []string{`"` + s + `"`}, Expected: item(s)})
+
+	s = strings.Repeat(`"`, 1024)
+	vs = append(vs, vector{Name: "large escaped string", HeaderType: "item", Raw: []string{`"` + strings.Repeat(`\"`, 1024) + `"`}, Expected: item(s)})
+
+	s = strings.Repeat("a", 512)
+	vs = append(vs, vector{Name: "large token", HeaderType: "item", Raw: []string{s}, Expected: item(token(s))})
+
+	return vs
+}
+
+func write(file string, vs []vector) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(vs); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("testdata", file), b.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,97 @@
+package headers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/httpfromtcp/internal/headers/sfv"
+)
+
+// Accessors for Structured Fields, RFC 9651. Repeated field lines are
+// joined before parsing, as the RFC requires. As with the other typed
+// accessors a missing field returns the zero value, and one that fails to
+// parse wraps both ErrInvalidHeaderValue and sfv.ErrSyntax.
+
+// Item returns the field key parsed as a structured Item.
+func (h *Headers) Item(key string) (sfv.Item, error) {
+	val, ok := h.structured(key)
+	if !ok {
+		return sfv.Item{}, nil
+	}
+	item, err := sfv.ParseItem(val)
+	if err != nil {
+		return sfv.Item{}, fmt.Errorf("%w: %s: %w", ErrInvalidHeaderValue, key, err)
+	}
+	return item, nil
+}
+
+// List returns the field key parsed as a structured List.
+func (h *Headers) List(key string) (sfv.List, error) {
+	val, ok := h.structured(key)
+	if !ok {
+		return nil, nil
+	}
+	list, err := sfv.ParseList(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidHeaderValue, key, err)
+	}
+	return list, nil
+}
+
+// Dictionary returns the field key parsed as a structured Dictionary.
+func (h *Headers) Dictionary(key string) (sfv.Dictionary, error) {
+	val, ok := h.structured(key)
+	if !ok {
+		return nil, nil
+	}
+	dict, err := sfv.ParseDictionary(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidHeaderValue, key, err)
+	}
+	return dict, nil
+}
+
+func (h *Headers) SetItem(key string, item sfv.Item) error {
+	val, err := sfv.SerializeItem(item)
+	if err != nil {
+		return err
+	}
+	return h.Set(key, val)
+}
+
+// SetList sets the field key to list. An empty list removes the field.
+func (h *Headers) SetList(key string, list sfv.List) error {
+	val, err := sfv.SerializeList(list)
+	if err != nil {
+		return err
+	}
+	if val == "" {
+		h.Del(key)
+		return nil
+	}
+	return h.Set(key, val)
+}
+
+// SetDictionary sets the field key to dict. An empty dictionary removes the
+// field.
+func (h *Headers) SetDictionary(key string, dict sfv.Dictionary) error {
+	val, err := sfv.SerializeDictionary(dict)
+	if err != nil {
+		return err
+	}
+	if val == "" {
+		h.Del(key)
+		return nil
+	}
+	return h.Set(key, val)
+}
+
+// structured joins the lines of the field key unlike Get, which special
+// cases Set-Cookie.
+func (h *Headers) structured(key string) (string, bool) {
+	vals := h.Values(key)
+	if vals == nil {
+		return "", false
+	}
+	return strings.Join(vals, ", "), true
+}
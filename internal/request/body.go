@@ -0,0 +1,54 @@
+package request
+
+import (
+	"errors"
+	"io"
+)
+
+// bodyReader decodes the body of r straight off the stream it was read from,
+// holding no more of it in memory than the reader's buffer.
+type bodyReader struct {
+	rr     *Reader
+	r      *Request
+	closed bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed request body")
+	}
+
+	for len(b.r.pending) == 0 {
+		if b.r.State == doneState {
+			return 0, io.EOF
+		}
+		if err := b.rr.parseBuffered(b.r, doneState); err != nil {
+			return 0, err
+		}
+		if len(b.r.pending) > 0 || b.r.State == doneState {
+			continue
+		}
+		if err := b.rr.fill(b.r); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, b.r.pending)
+	b.r.pending = b.r.pending[n:]
+	if len(b.r.pending) == 0 {
+		b.r.pending = nil
+	}
+	return n, nil
+}
+
+// Close discards the rest of the body so the stream is positioned at the
+// start of the next request. It returns an error if the body could not be
+// read to its end, in which case the stream can't be reused.
+func (b *bodyReader) Close() error {
+	if b.closed {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, b)
+	b.closed = true
+	return err
+}
@@ -0,0 +1,30 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned while reading a request. Parse failures wrap one of these
+// with the offending input, so callers should compare with errors.Is.
+var (
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	ErrMethodNotAllowed     = errors.New("method not allowed")
+	ErrUnsupportedVersion   = errors.New("unsupported HTTP version")
+	ErrInvalidHost          = errors.New("invalid Host")
+	ErrMalformedBody        = errors.New("malformed request body")
+	ErrBodyOverflow         = errors.New("body larger than Content-Length")
+	ErrIncompleteRequest    = errors.New("incomplete request")
+
+	// Errors refusing a body whose framing is ambiguous.
+	ErrInvalidContentLength      = errors.New("invalid Content-Length")
+	ErrInvalidTransferEncoding   = errors.New("invalid Transfer-Encoding")
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+
+	// ErrLimitExceeded is wrapped by every error reporting a request over
+	// one of its Limits.
+	ErrLimitExceeded      = errors.New("request limit exceeded")
+	ErrRequestLineTooLong = fmt.Errorf("%w: request line too long", ErrLimitExceeded)
+	ErrHeaderTooLarge     = fmt.Errorf("%w: header section too large", ErrLimitExceeded)
+	ErrBodyTooLarge       = fmt.Errorf("%w: request body too large", ErrLimitExceeded)
+)
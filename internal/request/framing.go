@@ -0,0 +1,57 @@
+package request
+
+import (
+	"fmt"
+)
+
+// framing works out how the request body is delimited, following RFC 9112
+// section 6.3. Anything that two parsers could read differently is refused
+// rather than guessed at, since a proxy in front of us may have guessed the
+// other way.
+func (r *Request) framing() (chunked bool, length int64, err error) {
+	hasTE := r.Headers.Has(te)
+	hasCL := r.Headers.Has(cl)
+
+	if hasTE {
+		if hasCL {
+			return false, 0, fmt.Errorf("%w: both Transfer-Encoding and Content-Length", ErrInvalidTransferEncoding)
+		}
+		if r.RequestLine.HttpVersion == "1.0" {
+			return false, 0, fmt.Errorf("%w: Transfer-Encoding in an HTTP/1.0 request", ErrInvalidTransferEncoding)
+		}
+		codings, err := r.Headers.TransferEncoding()
+		if err != nil {
+			return false, 0, fmt.Errorf("%w: %w", ErrInvalidTransferEncoding, err)
+		}
+		if err := checkTransferCodings(codings); err != nil {
+			return false, 0, err
+		}
+		return true, 0, nil
+	}
+
+	length, err = r.Headers.ContentLength()
+	if err != nil {
+		return false, 0, fmt.Errorf("%w: %w", ErrInvalidContentLength, err)
+	}
+	return false, max(length, 0), nil
+}
+
+// checkTransferCodings accepts a Transfer-Encoding list only when chunked is
+// its single, final coding; no other coding is implemented.
+func checkTransferCodings(codings []string) error {
+	if len(codings) == 0 {
+		return fmt.Errorf("%w: empty Transfer-Encoding", ErrInvalidTransferEncoding)
+	}
+
+	for i, coding := range codings {
+		if coding == "chunked" && i != len(codings)-1 {
+			return fmt.Errorf("%w: chunked is not the final coding in %q", ErrInvalidTransferEncoding, codings)
+		}
+	}
+	for _, coding := range codings {
+		if coding != "chunked" {
+			return fmt.Errorf("%w: %s", ErrUnsupportedTransferCoding, coding)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package request
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// resolveHost checks the Host header once the header section is complete and
+// sets r.Host, RFC 9112 section 3.2. An HTTP/1.1 request needs exactly one
+// Host header; when the target carries an authority, that takes precedence.
+func (r *Request) resolveHost() error {
+	hosts := r.Headers.Values("Host")
+	switch {
+	case len(hosts) == 0 && r.RequestLine.HttpVersion != "1.0":
+		return fmt.Errorf("%w: missing Host header", ErrInvalidHost)
+	case len(hosts) > 1:
+		return fmt.Errorf("%w: %d Host headers", ErrInvalidHost, len(hosts))
+	}
+
+	host, _ := r.Headers.Get("Host")
+	if !validHost(host) {
+		return fmt.Errorf("%w: %q", ErrInvalidHost, host)
+	}
+
+	if r.Target.Authority != "" {
+		host = r.Target.Authority
+		if !validHost(host) {
+			return fmt.Errorf("%w: %q in request target", ErrInvalidHost, host)
+		}
+	}
+
+	r.Host = strings.ToLower(host)
+	return nil
+}
+
+// validHost reports whether s is a uri-host with an optional port. An empty
+// host is allowed, for targets without an authority.
+func validHost(s string) bool {
+	host, port, hasPort := s, "", false
+
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return false
+		}
+		host = s[1:end]
+		rest := s[end+1:]
+		if rest != "" {
+			if rest[0] != ':' {
+				return false
+			}
+			port, hasPort = rest[1:], true
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil || !addr.Is6() || addr.Zone() != "" {
+			return false
+		}
+	} else {
+		if i := strings.LastIndexByte(s, ':'); i != -1 {
+			host, port, hasPort = s[:i], s[i+1:], true
+		}
+		if !validRegName(host) {
+			return false
+		}
+	}
+
+	return !hasPort || validPort(port)
+}
+
+// validRegName reports whether s is made of the characters allowed in a
+// registered name or IPv4 address.
+func validRegName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isUnreserved(c):
+		case strings.IndexByte("!$&'()*+,;=", c) != -1:
+		case c == '%':
+			if _, err := decodeEscape(s, i); err != nil {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validPort allows an empty port, as RFC 3986 does.
+func validPort(port string) bool {
+	if port == "" {
+		return true
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && isDigits(port) && n <= 65535
+}
@@ -0,0 +1,46 @@
+package request
+
+// Limits bounds how much of a request the parser will accept. A zero field
+// takes its value from DefaultLimits; a negative field means no limit.
+type Limits struct {
+	// MaxRequestLine is the longest request line accepted, CRLF excluded.
+	MaxRequestLine int
+	// MaxHeaderBytes bounds the header section, and separately the trailer
+	// section of a chunked body, counting every field line and its CRLF.
+	MaxHeaderBytes int
+	// MaxHeaders is the most field lines accepted in either section.
+	MaxHeaders int
+	// MaxBody is the largest decoded body accepted.
+	MaxBody int64
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLine: 8 << 10,
+	MaxHeaderBytes: 64 << 10,
+	MaxHeaders:     100,
+	MaxBody:        10 << 20,
+}
+
+// maxChunkSizeLine bounds a chunk-size line, extensions included.
+const maxChunkSizeLine = 4 << 10
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxRequestLine == 0 {
+		l.MaxRequestLine = DefaultLimits.MaxRequestLine
+	}
+	if l.MaxHeaderBytes == 0 {
+		l.MaxHeaderBytes = DefaultLimits.MaxHeaderBytes
+	}
+	if l.MaxHeaders == 0 {
+		l.MaxHeaders = DefaultLimits.MaxHeaders
+	}
+	if l.MaxBody == 0 {
+		l.MaxBody = DefaultLimits.MaxBody
+	}
+	return l
+}
+
+// exceeds reports whether n is over limit, where a negative limit never is.
+func exceeds[T int | int64](n, limit T) bool {
+	return limit >= 0 && n > limit
+}
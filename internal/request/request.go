@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -17,16 +18,52 @@ const (
 	initialState parserState = iota
 	parsingHeader
 	parsingBody
+	parsingFixedBody
+	parsingChunkSize
+	parsingChunkData
+	parsingChunkDataEnd
+	parsingTrailers
 	doneState
 )
 
-const cl = "Content-Length"
+const (
+	cl = "Content-Length"
+	te = "Transfer-Encoding"
+)
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	State       parserState
+	// Target is RequestLine.RequestTarget broken into its parts.
+	Target Target
+	// Params holds the path parameters matched by a router, by name. It is
+	// nil when no router has handled the request.
+	Params map[string]string
+	// Host is the lower-cased host and optional port the request is for,
+	// taken from an absolute-form target or else the Host header.
+	Host    string
+	Headers *headers.Headers
+	// Body holds the whole request body when the request was read with
+	// ReadRequest. ReadRequestHeader leaves it empty.
+	Body []byte
+	// BodyReader streams the request body. Closing it discards whatever
+	// the handler did not read so the next request can be parsed.
+	BodyReader io.ReadCloser
+	// Trailers holds the trailer section of a chunked request body. It is
+	// only complete once the body has been read to the end.
+	Trailers *headers.Headers
+	State    parserState
+
+	limits Limits
+	// fieldBytes and fieldCount track the header or trailer section being
+	// parsed against limits
+	fieldBytes int
+	fieldCount int
+
+	// pending holds decoded body bytes not yet handed out by BodyReader
+	pending        []byte
+	bodyRead       int64
+	bodyRemaining  int64
+	chunkRemaining int64
 }
 
 type RequestLine struct {
@@ -37,20 +74,24 @@ type RequestLine struct {
 
 const crlf = "\r\n"
 
-func (r *Request) parse(data []byte) (int, error) {
+// parse consumes as much of data as it can, stopping early once the request
+// reaches the until state.
+func (r *Request) parse(data []byte, until parserState) (int, error) {
 	totalBytesParsed := 0
 
-	for r.State != doneState {
+	for r.State < until {
+		state := r.State
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
 		}
 
-		if n == 0 {
+		totalBytesParsed += n
+
+		// nothing consumed and nowhere new to go: wait for more data
+		if n == 0 && r.State == state {
 			break
 		}
-
-		totalBytesParsed += n
 	}
 	return totalBytesParsed, nil
 
@@ -61,26 +102,46 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.State {
 
 	case initialState:
+		// empty lines before the request line, such as a stray CRLF after
+		// the previous request's body, are to be ignored
+		if bytes.HasPrefix(data, []byte(crlf)) {
+			return len(crlf), nil
+		}
+
+		lineLen := bytes.Index(data, []byte(crlf))
+		if lineLen == -1 {
+			lineLen = len(data)
+		}
+		if exceeds(lineLen, r.limits.MaxRequestLine) {
+			return 0, ErrRequestLineTooLong
+		}
+
 		rl, consumed, err := parseRequestLine(data)
 
 		if err != nil {
-			return 0, nil
+			return 0, err
 		}
 
 		if consumed == 0 {
 			return 0, nil
 		}
 
+		target, err := parseTarget(rl.Method, rl.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
+
 		r.RequestLine = *rl
+		r.Target = target
 
 		r.State = parsingHeader
 
 		return consumed, nil
 
 	case parsingHeader:
-		consumed, done, err := r.Headers.Parse(data)
+		consumed, done, err := r.parseField(r.Headers, data)
 		if err != nil {
-			return 0, nil
+			return 0, err
 		}
 
 		if consumed == 0 {
@@ -88,37 +149,110 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		}
 
 		if done {
+			if err := r.resolveHost(); err != nil {
+				return 0, err
+			}
 			r.State = parsingBody
+			return consumed, nil
 		}
 		return consumed, nil
 
 	case parsingBody:
-		val, err := r.Headers.Get(cl)
-
+		chunked, n, err := r.framing()
 		if err != nil {
+			return 0, err
+		}
+
+		if chunked {
+			r.State = parsingChunkSize
+			return 0, nil
+		}
+
+		if n == 0 {
 			r.State = doneState
 			return 0, nil
 		}
 
-		n, err := strconv.Atoi(val)
-		if n <= 0 {
+		if exceeds(n, r.limits.MaxBody) {
+			return 0, ErrBodyTooLarge
+		}
+
+		r.bodyRemaining = n
+		r.State = parsingFixedBody
+		return 0, nil
+
+	case parsingFixedBody:
+		// only take what Content-Length promises; anything after it
+		// belongs to the next request on the connection
+		n := min(r.bodyRemaining, int64(len(data)))
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyRead += n
+		r.bodyRemaining -= n
+
+		if r.bodyRemaining == 0 {
 			r.State = doneState
+		}
+
+		return int(n), nil
+
+	case parsingChunkSize:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			if len(data) > maxChunkSizeLine {
+				return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedBody)
+			}
 			return 0, nil
 		}
 
-		if len(data) > 0 {
-			r.Body = append(r.Body, data...)
+		size, err := parseChunkSize(data[:idx])
+		if err != nil {
+			return 0, err
 		}
 
-		if len(r.Body) > n {
-			return 0, fmt.Errorf("body larger than Content-Length (expected %d, got %d+)", n, len(r.Body))
+		if exceeds(r.bodyRead+size, r.limits.MaxBody) {
+			return 0, ErrBodyTooLarge
 		}
 
-		if len(r.Body) == n {
-			r.State = doneState
+		if size == 0 {
+			r.fieldBytes, r.fieldCount = 0, 0
+			r.State = parsingTrailers
+		} else {
+			r.chunkRemaining = size
+			r.State = parsingChunkData
+		}
+		return idx + len(crlf), nil
+
+	case parsingChunkData:
+		n := min(r.chunkRemaining, int64(len(data)))
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyRead += n
+		r.chunkRemaining -= n
+
+		if r.chunkRemaining == 0 {
+			r.State = parsingChunkDataEnd
+		}
+		return int(n), nil
+
+	case parsingChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("%w: chunk data not followed by CRLF", ErrMalformedBody)
 		}
+		r.State = parsingChunkSize
+		return len(crlf), nil
 
-		return len(data), nil
+	case parsingTrailers:
+		consumed, done, err := r.parseField(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
+			r.State = doneState
+		}
+		return consumed, nil
 
 	case doneState:
 		return 0, nil
@@ -128,46 +262,225 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	r := &Request{
-		State:   initialState,
-		Headers: headers.NewHeaders(),
+// parseField parses one line of a header or trailer section into h,
+// enforcing the section limits.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+	lineLen := len(data)
+	if idx := bytes.Index(data, []byte(crlf)); idx != -1 {
+		lineLen = idx + len(crlf)
+	}
+	if exceeds(r.fieldBytes+lineLen, r.limits.MaxHeaderBytes) {
+		return 0, false, ErrHeaderTooLarge
 	}
-	buf := make([]byte, 8)
-	readToIndex := 0
 
-	for r.State != doneState {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
+	consumed, done, err := h.Parse(data)
+	if err != nil || consumed == 0 || done {
+		return consumed, done, err
+	}
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
+	r.fieldBytes += consumed
+	r.fieldCount++
+	if exceeds(r.fieldCount, r.limits.MaxHeaders) {
+		return 0, false, ErrHeaderTooLarge
+	}
+	return consumed, false, nil
+}
 
-		if err != nil {
+// RequestFromReader reads a request that makes up the whole of reader, so
+// it reads on until EOF: anything after the request is an ErrBodyOverflow.
+// Requests on a connection that stays open, or that carries more than one,
+// are read with a Reader instead.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	rr := NewReader(reader)
+	r, err := rr.ReadRequest()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: EOF before end of headers", ErrIncompleteRequest)
+		}
+		return nil, err
+	}
+	for rr.readToIndex == 0 {
+		n, err := rr.reader.Read(rr.buf)
+		rr.readToIndex = n
+		if err != nil && n == 0 {
 			if errors.Is(err, io.EOF) {
-				if r.State != doneState {
-					return nil, fmt.Errorf("incomplete request (EOF before end of headers)")
-				}
-				break
+				return r, nil
 			}
 			return nil, err
 		}
-		readToIndex += numBytesRead
+	}
+	return nil, fmt.Errorf("%w: unexpected bytes after the request", ErrBodyOverflow)
+}
 
-		numBytesParsed, err := r.parse(buf[:readToIndex])
-		if err != nil {
+// Reader reads successive requests from a single stream, such as a
+// kept-alive or pipelined connection. Bytes read past the end of one request
+// stay in its buffer and are parsed as the start of the next.
+type Reader struct {
+	// Limits applies to every request read after it is set.
+	Limits Limits
+	// ObsFold is what to do with header and trailer lines folded onto the
+	// next line. The default rejects them.
+	ObsFold headers.ObsFold
+
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+}
+
+// readBufferSize is how much a Reader reads from its stream at a time. The
+// buffer only grows past it for a request line or header field that doesn't
+// fit.
+const readBufferSize = 16 << 10
+
+func NewReader(reader io.Reader) *Reader {
+	return newReader(reader, readBufferSize)
+}
+
+func newReader(reader io.Reader, size int) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, size),
+	}
+}
+
+// Buffered returns how many bytes past the last request have been read
+// from the stream but not parsed yet.
+func (rr *Reader) Buffered() int {
+	return rr.readToIndex
+}
+
+// ReadRequest returns the next request on the stream with its whole body
+// read into Body. A clean EOF before any bytes of a new request arrive is
+// reported as io.EOF.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	r, err := rr.ReadRequestHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+	r.BodyReader = io.NopCloser(bytes.NewReader(body))
+	return r, nil
+}
+
+// ReadRequestHeader returns the next request on the stream as soon as its
+// header section has been parsed. The body is left on the stream to be read
+// through the request's BodyReader, which must be closed before the next
+// call.
+func (rr *Reader) ReadRequestHeader() (*Request, error) {
+	r := &Request{
+		State:    initialState,
+		Headers:  &headers.Headers{ObsFold: rr.ObsFold},
+		Trailers: &headers.Headers{ObsFold: rr.ObsFold},
+		limits:   rr.Limits.withDefaults(),
+	}
+
+	// stop once the body framing is known, so a body that is too large is
+	// refused before anyone reads it
+	for {
+		if err := rr.parseBuffered(r, parsingFixedBody); err != nil {
+			return nil, err
+		}
+		if r.State >= parsingFixedBody {
+			break
+		}
+		if err := rr.fill(r); err != nil {
 			return nil, err
 		}
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
-
 	}
 
+	r.BodyReader = &bodyReader{rr: rr, r: r}
 	return r, nil
 }
 
+// parseBuffered feeds the buffered bytes to r and drops whatever it consumed.
+func (rr *Reader) parseBuffered(r *Request, until parserState) error {
+	numBytesParsed, err := r.parse(rr.buf[:rr.readToIndex], until)
+	if err != nil {
+		return err
+	}
+	copy(rr.buf, rr.buf[numBytesParsed:rr.readToIndex])
+	rr.readToIndex -= numBytesParsed
+	return nil
+}
+
+// fill reads more of the stream into the buffer, growing it when it is full.
+func (rr *Reader) fill(r *Request) error {
+	if rr.readToIndex >= len(rr.buf) {
+		newBuf := make([]byte, len(rr.buf)*2)
+		copy(newBuf, rr.buf)
+		rr.buf = newBuf
+	}
+
+	numBytesRead, err := rr.reader.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += numBytesRead
+
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		if numBytesRead > 0 {
+			// parse what came in with the EOF before giving up
+			return nil
+		}
+		if r.State == initialState && rr.readToIndex == 0 {
+			return io.EOF
+		}
+		return fmt.Errorf("%w: EOF before end of request", ErrIncompleteRequest)
+	}
+	return nil
+}
+
+// BodyPending reports whether part of the body has yet to be read through
+// BodyReader.
+func (r *Request) BodyPending() bool {
+	return r.State != doneState || len(r.pending) > 0
+}
+
+// KeepAlive reports whether the client is willing to send another request
+// on the same connection once this one has been answered. HTTP/1.1
+// connections persist unless the client asks to close; HTTP/1.0 ones only
+// when it asks to keep them alive.
+func (r *Request) KeepAlive() bool {
+	keepAlive := r.RequestLine.HttpVersion != "1.0"
+	for _, opt := range r.Headers.Connection() {
+		switch opt {
+		case "close":
+			return false
+		case "keep-alive":
+			keepAlive = true
+		}
+	}
+	return keepAlive
+}
+
+// parseChunkSize parses a chunk-size line, ignoring any chunk extensions.
+func parseChunkSize(line []byte) (int64, error) {
+	if i := bytes.IndexByte(line, ';'); i != -1 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+
+	if len(line) == 0 || len(line) > 15 {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedBody, line)
+	}
+	// chunk-size is 1*HEXDIG; ParseInt alone would also take a sign
+	for _, c := range line {
+		if !isHex(c) {
+			return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedBody, line)
+		}
+	}
+	size, err := strconv.ParseInt(string(line), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedBody, line)
+	}
+	return size, nil
+}
+
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte(crlf))
 	if idx == -1 {
@@ -181,38 +494,51 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	return requestLine, idx + len([]byte(crlf)), nil
 }
 
+// Methods lists the request methods the parser accepts. Any other
+// well-formed method is rejected with ErrMethodNotAllowed.
+var Methods = []string{
+	"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH",
+}
+
 func requestLineFromString(str string) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, fmt.Errorf("%w: %q", ErrMalformedRequestLine, str)
 	}
 
-	method := parts[0]
-	for _, c := range method {
-		if c < 'A' || c > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
-		}
-	}
-
-	requestTarget := parts[1]
-
+	// the version is checked first so that a client speaking another
+	// protocol version, like an HTTP/2 preface, is told so
 	versionParts := strings.Split(parts[2], "/")
-	if len(versionParts) != 2 {
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+	if len(versionParts) != 2 || versionParts[0] != "HTTP" || !isVersionNumber(versionParts[1]) {
+		return nil, fmt.Errorf("%w: %q", ErrMalformedRequestLine, str)
+	}
+	version := versionParts[1]
+	if version != "1.1" && version != "1.0" {
+		return nil, fmt.Errorf("%w: HTTP/%s", ErrUnsupportedVersion, version)
 	}
 
-	httpPart := versionParts[0]
-	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
+	method := parts[0]
+	if !headers.IsToken(method) {
+		return nil, fmt.Errorf("%w: invalid method %q", ErrMalformedRequestLine, method)
 	}
-	version := versionParts[1]
-	if version != "1.1" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", version)
+	if !slices.Contains(Methods, method) {
+		return nil, fmt.Errorf("%w: %s", ErrMethodNotAllowed, method)
+	}
+
+	requestTarget := parts[1]
+	if requestTarget == "" {
+		return nil, fmt.Errorf("%w: empty request target", ErrMalformedRequestLine)
 	}
 
 	return &RequestLine{
 		Method:        method,
 		RequestTarget: requestTarget,
-		HttpVersion:   versionParts[1],
+		HttpVersion:   version,
 	}, nil
 }
+
+// isVersionNumber reports whether s has the DIGIT "." DIGIT form of an
+// HTTP-version.
+func isVersionNumber(s string) bool {
+	return len(s) == 3 && s[0] >= '0' && s[0] <= '9' && s[1] == '.' && s[2] >= '0' && s[2] <= '9'
+}
@@ -2,8 +2,10 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
+	"github.com/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,6 +30,10 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
 func TestRequestLineParse(t *testing.T) {
 
 	// Test: Good GET Request line
@@ -42,6 +48,15 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "/", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 
+	// Test: Empty lines before the request line are ignored
+	reader = &chunkReader{
+		data:            "\r\n\r\nGET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+
 	// Test: Good GET Request line with path
 	reader = &chunkReader{
 		data:            "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -98,9 +113,12 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	host, _ := r.Headers.Get("host")
+	assert.Equal(t, "localhost:42069", host)
+	userAgent, _ := r.Headers.Get("user-agent")
+	assert.Equal(t, "curl/7.81.0", userAgent)
+	accept, _ := r.Headers.Get("accept")
+	assert.Equal(t, "*/*", accept)
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -175,3 +193,680 @@ func TestBody(t *testing.T) {
 	assert.Equal(t, "", string(r.Body))
 
 }
+
+func TestReader(t *testing.T) {
+	// Test: Pipelined requests come back in order
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"GET /tea HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	}
+	// a tiny buffer has to grow to hold each line
+	rr := newReader(reader, 8)
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+	host, _ := r.Headers.Get("host")
+	assert.Equal(t, "localhost:42069", host)
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/tea", r.RequestLine.RequestTarget)
+
+	// Test: Clean EOF before the next request arrives
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Whole pipeline delivered in a single read
+	reader = &chunkReader{
+		data: "GET /a HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"GET /b HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 1024,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/a", r.RequestLine.RequestTarget)
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/b", r.RequestLine.RequestTarget)
+
+	// Test: Bodies are read in large blocks
+	reader = &chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 65536\r\n\r\n" + strings.Repeat("a", 65536),
+		numBytesPerRead: 1 << 20,
+	}
+	reads := 0
+	rr = NewReader(readerFunc(func(p []byte) (int, error) {
+		reads++
+		return reader.Read(p)
+	}))
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Len(t, r.Body, 65536)
+	assert.LessOrEqual(t, reads, 8)
+
+	// Test: EOF in the middle of a pipelined request
+	reader = &chunkReader{
+		data:            "GET /a HTTP/1.1\r\nHost: localhost:42069\r\n\r\nGET /b HTT",
+		numBytesPerRead: 5,
+	}
+	rr = NewReader(reader)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = rr.ReadRequest()
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, io.EOF)
+}
+
+func TestKeepAlive(t *testing.T) {
+	// Test: HTTP/1.1 defaults to keep-alive
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: Connection: close
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: Close\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 defaults to close
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 opting into keep-alive
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+}
+
+func TestChunkedBody(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, 0, r.Trailers.Len())
+
+	// Test: Chunk extensions, hex sizes and trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"1a;name=value;flag\r\n" +
+			"abcdefghijklmnopqrstuvwxyz\r\n" +
+			"0;last\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(r.Body))
+	checksum, _ := r.Trailers.Get("x-checksum")
+	assert.Equal(t, "abc123", checksum)
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 1024,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "", string(r.Body))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"xyz\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Signed chunk sizes
+	for _, size := range []string{"+3", "-0"} {
+		reader = &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				size + "\r\n" +
+				"abc\r\n" +
+				"0\r\n" +
+				"\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrMalformedBody, size)
+	}
+
+	// Test: Chunk data longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestBodyReader(t *testing.T) {
+	// Test: Streamed Content-Length body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "POST", r.RequestLine.Method)
+	assert.Empty(t, r.Body)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
+
+	// Test: Streamed chunked body with trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\n" +
+			"hello \r\n" +
+			"7\r\n" +
+			"world!\n\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(r.BodyReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	body, err = io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, " world!\n", string(body))
+	checksum, _ := r.Trailers.Get("x-checksum")
+	assert.Equal(t, "abc123", checksum)
+
+	// Test: Closing an unread body skips to the next request
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n" +
+			"GET /coffee HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(buf)
+	require.Error(t, err)
+	r, err = rr.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+
+	// Test: Body cut short by EOF
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	r, err = rr.ReadRequestHeader()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.Error(t, err)
+	require.Error(t, r.BodyReader.Close())
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLine: 32,
+		MaxHeaderBytes: 64,
+		MaxHeaders:     3,
+		MaxBody:        16,
+	}
+
+	// Test: Request line within limit
+	reader := &chunkReader{
+		data:            "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	rr.Limits = limits
+	_, err := rr.ReadRequest()
+	require.NoError(t, err)
+
+	// Test: Request line too long, even before its CRLF arrives
+	reader = &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 64),
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Endless header line
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Junk: " + strings.Repeat("a", 128),
+		numBytesPerRead: 7,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Too many headers
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Content-Length over the limit is refused before the body is read
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 17\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequestHeader()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body growing past the limit
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a\r\n" +
+			"0123456789\r\n" +
+			"a\r\n" +
+			"0123456789\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Negative limits disable the check
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 26\r\n" +
+			"\r\n" +
+			"abcdefghijklmnopqrstuvwxyz",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = Limits{MaxBody: -1}
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(r.Body))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		numBytesPerRead int
+		err             error
+	}{
+		{"Missing request target", "GET HTTP/1.1\r\n\r\n", 3, ErrMalformedRequestLine},
+		{"Garbage request line", "hello there\r\n\r\n", 3, ErrMalformedRequestLine},
+		{"Malformed version", "GET / HTTP/one\r\n\r\n", 3, ErrMalformedRequestLine},
+		{"Invalid method characters", "G(T / HTTP/1.1\r\n\r\n", 3, ErrMalformedRequestLine},
+		{"Unknown method", "BREW /pot HTTP/1.1\r\n\r\n", 3, ErrMethodNotAllowed},
+		{"Lowercase method", "get / HTTP/1.1\r\n\r\n", 3, ErrMethodNotAllowed},
+		{"Future HTTP/1 minor version", "GET / HTTP/1.2\r\n\r\n", 3, ErrUnsupportedVersion},
+		{"HTTP/2 preface", "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", 3, ErrUnsupportedVersion},
+		{"Missing colon", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", 3, headers.ErrMalformedHeader},
+		{"Space before colon", "GET / HTTP/1.1\r\nHost : localhost:42069\r\n\r\n", 3, headers.ErrInvalidHeaderName},
+		{"NUL in header value", "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Name: a\x00b\r\n\r\n", 3, headers.ErrInvalidHeaderValue},
+		{"Bare CR in header value", "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Name: a\rb\r\n\r\n", 3, headers.ErrInvalidHeaderValue},
+		{"Folded header line", "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Name: a\r\n b\r\n\r\n", 3, headers.ErrMalformedHeader},
+		{"Incomplete headers", "GET / HTTP/1.1\r\nHost: localhost:42069\r\n", 3, ErrIncompleteRequest},
+		{"Body shorter than Content-Length", "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\npartial", 3, ErrIncompleteRequest},
+		{"Body longer than Content-Length", "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 2\r\n\r\nmore than two", 1024, ErrBodyOverflow},
+		{"Invalid chunk size", "POST / HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", 3, ErrMalformedBody},
+		{"Missing Host", "GET / HTTP/1.1\r\nAccept: */*\r\n\r\n", 3, ErrInvalidHost},
+		{"Duplicate Host", "GET / HTTP/1.1\r\nHost: a.example\r\nHost: a.example\r\n\r\n", 3, ErrInvalidHost},
+		{"Invalid Host", "GET / HTTP/1.1\r\nHost: bad host\r\n\r\n", 3, ErrInvalidHost},
+		{"Invalid Host port", "GET / HTTP/1.1\r\nHost: example.com:http\r\n\r\n", 3, ErrInvalidHost},
+		{"Unbracketed IPv6 Host", "GET / HTTP/1.1\r\nHost: ::1\r\n\r\n", 3, ErrInvalidHost},
+		{"Invalid IPv6 Host", "GET / HTTP/1.1\r\nHost: [::g]:80\r\n\r\n", 3, ErrInvalidHost},
+		{"Request line over limit", "GET /" + strings.Repeat("a", 10<<10) + " HTTP/1.1\r\n\r\n", 3, ErrLimitExceeded},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := &chunkReader{
+				data:            tc.data,
+				numBytesPerRead: tc.numBytesPerRead,
+			}
+			_, err := RequestFromReader(reader)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		form     TargetForm
+		scheme   string
+		auth     string
+		path     string
+		rawQuery string
+		query    Query
+	}{
+		{"Root", "GET / HTTP/1.1", OriginForm, "", "", "/", "", Query{}},
+		{"Path and query", "GET /video?x=1 HTTP/1.1", OriginForm, "", "", "/video", "x=1", Query{"x": {"1"}}},
+		{"Repeated and encoded query values", "GET /search?q=a+b&q=c%26d&empty= HTTP/1.1", OriginForm, "", "", "/search", "q=a+b&q=c%26d&empty=", Query{"q": {"a b", "c&d"}, "empty": {""}}},
+		{"Percent-decoded path", "GET /caf%C3%A9/menu%20board HTTP/1.1", OriginForm, "", "", "/café/menu board", "", Query{}},
+		{"Dot-segments", "GET /a/b/../c/./d HTTP/1.1", OriginForm, "", "", "/a/c/d", "", Query{}},
+		{"Trailing dot-segment", "GET /a/b/.. HTTP/1.1", OriginForm, "", "", "/a/", "", Query{}},
+		{"Dot-segments above the root", "GET /../../etc/passwd HTTP/1.1", OriginForm, "", "", "/etc/passwd", "", Query{}},
+		{"Encoded dot-segments", "GET /a/%2e%2E/b HTTP/1.1", OriginForm, "", "", "/b", "", Query{}},
+		{"Absolute-form", "GET HTTP://example.com:8080/coffee?cups=2 HTTP/1.1", AbsoluteForm, "http", "example.com:8080", "/coffee", "cups=2", Query{"cups": {"2"}}},
+		{"Absolute-form without path", "GET http://example.com HTTP/1.1", AbsoluteForm, "http", "example.com", "/", "", Query{}},
+		{"Authority-form", "CONNECT example.com:443 HTTP/1.1", AuthorityForm, "", "example.com:443", "", "", Query{}},
+		{"Authority-form with IPv6", "CONNECT [::1]:443 HTTP/1.1", AuthorityForm, "", "[::1]:443", "", "", Query{}},
+		{"Asterisk-form", "OPTIONS * HTTP/1.1", AsteriskForm, "", "", "", "", Query{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := &chunkReader{
+				data:            tc.line + "\r\nHost: localhost:42069\r\n\r\n",
+				numBytesPerRead: 3,
+			}
+			r, err := RequestFromReader(reader)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			assert.Equal(t, tc.form, r.Target.Form)
+			assert.Equal(t, tc.scheme, r.Target.Scheme)
+			assert.Equal(t, tc.auth, r.Target.Authority)
+			assert.Equal(t, tc.path, r.Target.Path)
+			assert.Equal(t, tc.rawQuery, r.Target.RawQuery)
+			assert.Equal(t, tc.query, r.Target.Query)
+		})
+	}
+
+	// Test: Encoded slash stays distinguishable in RawPath
+	reader := &chunkReader{
+		data:            "GET /files/a%2fb HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/files/a/b", r.Target.Path)
+	assert.Equal(t, "/files/a%2Fb", r.Target.RawPath)
+	assert.Equal(t, "", r.Target.Query.Get("missing"))
+
+	// Test: Invalid targets
+	for _, line := range []string{
+		"GET * HTTP/1.1",
+		"GET coffee HTTP/1.1",
+		"GET /bad%zzescape HTTP/1.1",
+		"GET /trailing% HTTP/1.1",
+		"GET /frag#ment HTTP/1.1",
+		"GET /q?x=%G1 HTTP/1.1",
+		"GET http:///nohost HTTP/1.1",
+		"CONNECT example.com HTTP/1.1",
+		"CONNECT [::1] HTTP/1.1",
+		"CONNECT :443 HTTP/1.1",
+		"CONNECT example.com:99999 HTTP/1.1",
+		"CONNECT exa|mple.com:443 HTTP/1.1",
+	} {
+		reader := &chunkReader{
+			data:            line + "\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err := RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrMalformedRequestLine, line)
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		host string
+	}{
+		{"Host with port", "GET / HTTP/1.1\r\nHost: LocalHost:42069\r\n\r\n", "localhost:42069"},
+		{"Host without port", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", "example.com"},
+		{"IPv4 Host", "GET / HTTP/1.1\r\nHost: 127.0.0.1:8080\r\n\r\n", "127.0.0.1:8080"},
+		{"IPv6 Host", "GET / HTTP/1.1\r\nHost: [::1]:8080\r\n\r\n", "[::1]:8080"},
+		{"IPv6 Host without port", "GET / HTTP/1.1\r\nHost: [2001:db8::1]\r\n\r\n", "[2001:db8::1]"},
+		{"Empty Host", "GET / HTTP/1.1\r\nHost:\r\n\r\n", ""},
+		{"Absolute-form wins over Host", "GET http://origin.example/ HTTP/1.1\r\nHost: proxy.example\r\n\r\n", "origin.example"},
+		{"Authority-form", "CONNECT origin.example:443 HTTP/1.1\r\nHost: origin.example:443\r\n\r\n", "origin.example:443"},
+		{"HTTP/1.0 without Host", "GET / HTTP/1.0\r\n\r\n", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := &chunkReader{
+				data:            tc.data,
+				numBytesPerRead: 3,
+			}
+			r, err := RequestFromReader(reader)
+			require.NoError(t, err)
+			require.NotNil(t, r)
+			assert.Equal(t, tc.host, r.Host)
+		})
+	}
+}
+
+func TestFraming(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		err     error
+	}{
+		{"Non-numeric Content-Length", "Content-Length: five\r\n", ErrInvalidContentLength},
+		{"Signed Content-Length", "Content-Length: +5\r\n", ErrInvalidContentLength},
+		{"Negative Content-Length", "Content-Length: -1\r\n", ErrInvalidContentLength},
+		{"Overflowing Content-Length", "Content-Length: 99999999999999999999\r\n", ErrInvalidContentLength},
+		{"Conflicting Content-Length headers", "Content-Length: 5\r\nContent-Length: 6\r\n", ErrInvalidContentLength},
+		{"Conflicting Content-Length list", "Content-Length: 5, 6\r\n", ErrInvalidContentLength},
+		{"Empty Content-Length list member", "Content-Length: 5,,5\r\n", ErrInvalidContentLength},
+		{"Content-Length and Transfer-Encoding", "Content-Length: 5\r\nTransfer-Encoding: chunked\r\n", ErrInvalidTransferEncoding},
+		{"Chunked not final", "Transfer-Encoding: chunked, identity\r\n", ErrInvalidTransferEncoding},
+		{"Chunked twice", "Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n", ErrInvalidTransferEncoding},
+		{"Empty Transfer-Encoding", "Transfer-Encoding: ,\r\n", ErrInvalidTransferEncoding},
+		{"Unknown transfer coding", "Transfer-Encoding: gzip, chunked\r\n", ErrUnsupportedTransferCoding},
+		{"Transfer-Encoding without chunked", "Transfer-Encoding: gzip\r\n", ErrUnsupportedTransferCoding},
+		{"Whitespace before colon", "Content-Length : 5\r\n", headers.ErrInvalidHeaderName},
+		{"Tab before colon", "Transfer-Encoding\t: chunked\r\n", headers.ErrInvalidHeaderName},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := &chunkReader{
+				data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\n" + tc.headers + "\r\nhello",
+				numBytesPerRead: 3,
+			}
+			_, err := RequestFromReader(reader)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	// Test: Transfer-Encoding in an HTTP/1.0 request
+	reader := &chunkReader{
+		data:            "POST /submit HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrInvalidTransferEncoding)
+
+	// Test: Repeated identical Content-Length
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Transfer codings are case-insensitive
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Whitespace before colon in a trailer
+	reader = &chunkReader{
+		data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Checksum : abc\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, headers.ErrInvalidHeaderName)
+}
+
+func TestObsFold(t *testing.T) {
+	// Test: Folded lines joined with a space
+	reader := &chunkReader{
+		data: "GET / HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"X-Long: first\r\n" +
+			" second\r\n" +
+			"\t  third\r\n" +
+			"Accept: */*\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	rr := NewReader(reader)
+	rr.ObsFold = headers.ReplaceObsFold
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	long, _ := r.Headers.Get("X-Long")
+	assert.Equal(t, "first second third", long)
+	accept, _ := r.Headers.Get("Accept")
+	assert.Equal(t, "*/*", accept)
+
+	// Test: Folded first line
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n Host: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.ObsFold = headers.ReplaceObsFold
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, headers.ErrMalformedHeader)
+}
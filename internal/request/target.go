@@ -0,0 +1,296 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TargetForm int
+
+// The four forms a request target can take, RFC 9112 section 3.2.
+const (
+	OriginForm    TargetForm = iota // /path?query
+	AbsoluteForm                    // http://host/path?query, sent to proxies
+	AuthorityForm                   // host:port, only with CONNECT
+	AsteriskForm                    // *, only with OPTIONS
+)
+
+// Target is a parsed request target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set, lower-cased, for absolute-form targets.
+	Scheme string
+	// Authority is the host and optional port of absolute-form and
+	// authority-form targets.
+	Authority string
+	// Path is the percent-decoded path with dot-segments removed. It is
+	// empty for authority-form and asterisk-form targets.
+	Path string
+	// RawPath is Path before percent-decoding, so "%2F" can still be told
+	// apart from "/".
+	RawPath  string
+	RawQuery string
+	// Query holds the decoded query parameters. It is never nil.
+	Query Query
+}
+
+// Query maps each query parameter to its values, in the order they appeared.
+type Query map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (q Query) Get(key string) string {
+	if vals := q[key]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (q Query) Has(key string) bool {
+	_, ok := q[key]
+	return ok
+}
+
+func parseTarget(method, target string) (Target, error) {
+	t := Target{Query: Query{}}
+
+	switch {
+	case target == "*":
+		if method != "OPTIONS" {
+			return t, fmt.Errorf("%w: asterisk-form target with %s", ErrMalformedRequestLine, method)
+		}
+		t.Form = AsteriskForm
+		return t, nil
+
+	case method == "CONNECT":
+		// authority-form is uri-host ":" port, the host possibly an IPv6
+		// literal with colons of its own
+		i := strings.LastIndexByte(target, ':')
+		if i <= 0 || !isDigits(target[i+1:]) || !validHost(target) {
+			return t, fmt.Errorf("%w: invalid authority-form target %q", ErrMalformedRequestLine, target)
+		}
+		t.Form = AuthorityForm
+		t.Authority = target
+		return t, nil
+
+	case strings.HasPrefix(target, "/"):
+		t.Form = OriginForm
+
+	default:
+		scheme, rest, ok := strings.Cut(target, "://")
+		if !ok || !isScheme(scheme) {
+			return t, fmt.Errorf("%w: invalid request target %q", ErrMalformedRequestLine, target)
+		}
+		t.Form = AbsoluteForm
+		t.Scheme = strings.ToLower(scheme)
+
+		end := strings.IndexAny(rest, "/?")
+		if end == -1 {
+			end = len(rest)
+		}
+		t.Authority = rest[:end]
+		if t.Authority == "" {
+			return t, fmt.Errorf("%w: missing authority in %q", ErrMalformedRequestLine, target)
+		}
+
+		target = rest[end:]
+		if !strings.HasPrefix(target, "/") {
+			// an empty path in absolute-form means the root
+			target = "/" + target
+		}
+	}
+
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	if !validTargetPart(rawPath, "/") || !validTargetPart(rawQuery, "/?") {
+		return t, fmt.Errorf("%w: invalid character in request target %q", ErrMalformedRequestLine, target)
+	}
+
+	rawPath, err := normalizeEscapes(rawPath)
+	if err != nil {
+		return t, err
+	}
+	t.RawPath = removeDotSegments(rawPath)
+	t.Path, err = unescape(t.RawPath, false)
+	if err != nil {
+		return t, err
+	}
+
+	t.RawQuery = rawQuery
+	if err := parseQuery(t.Query, rawQuery); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// parseQuery adds the key=value pairs of a query string to q, decoding them
+// the way HTML forms encode them.
+func parseQuery(q Query, rawQuery string) error {
+	for pair := range strings.SplitSeq(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawVal, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return err
+		}
+		val, err := unescape(rawVal, true)
+		if err != nil {
+			return err
+		}
+		q[key] = append(q[key], val)
+	}
+	return nil
+}
+
+// removeDotSegments resolves "." and ".." segments in an absolute path as
+// described in RFC 3986 section 5.2.4. A ".." never climbs above the root.
+func removeDotSegments(path string) string {
+	segments := strings.Split(path[1:], "/")
+	out := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+		// a trailing dot-segment still names a directory
+		if last {
+			out = append(out, "")
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters, which
+// never needed encoding, and upper-cases the hex digits of every other
+// escape. "%2e%2E" therefore becomes ".." before dot-segments are removed.
+func normalizeEscapes(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		c, err := decodeEscape(s, i)
+		if err != nil {
+			return "", err
+		}
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func unescape(s string, plusAsSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%':
+			c, err := decodeEscape(s, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteByte(c)
+			i += 2
+		case s[i] == '+' && plusAsSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// decodeEscape decodes the escape starting at the '%' at s[i].
+func decodeEscape(s string, i int) (byte, error) {
+	if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+		return 0, fmt.Errorf("%w: invalid escape in %q", ErrMalformedRequestLine, s)
+	}
+	return unhex(s[i+1])<<4 | unhex(s[i+2]), nil
+}
+
+// validTargetPart reports whether every byte of s may appear in a path or
+// query: pchar, plus the extra characters given.
+func validTargetPart(s, extra string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isUnreserved(c):
+		case strings.IndexByte("!$&'()*+,;=:@%", c) != -1:
+		case strings.IndexByte(extra, c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isScheme(s string) bool {
+	if s == "" || !isAlpha(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isUnreserved(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
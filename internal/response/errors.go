@@ -0,0 +1,32 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by a Writer for a body that doesn't fit the response.
+var (
+	ErrBodyOverflow = errors.New("body larger than Content-Length")
+	ErrShortBody    = errors.New("body shorter than Content-Length")
+
+	// ErrBodyNotAllowed is returned when writing a body for a status that
+	// can't have one, such as 204 or 304.
+	ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+	// ErrDeadlineNotSupported is returned when setting a deadline on a
+	// Writer that isn't writing to a connection.
+	ErrDeadlineNotSupported = errors.New("writer has no connection to set deadlines on")
+)
+
+// StateError is returned when a Writer method is called out of order, such
+// as writing the body before the headers. Nothing is written to the client.
+type StateError struct {
+	// Op is the Writer method that was called.
+	Op    string
+	State WriterState
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("response: %s called while %s", e.Op, e.State)
+}
@@ -9,49 +9,52 @@ import (
 
 const httpVersion = "1.1"
 
-type StatusCode int
+func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+	return writeStatusLine(w, httpVersion, statusCode)
+}
 
-const (
-	Ok                  StatusCode = 200
-	BadRequest          StatusCode = 400
-	InternalServerError StatusCode = 500
-)
+// WriteStatusLineReason writes a status line with a custom reason phrase,
+// which may be empty. Any three-digit code is accepted.
+func WriteStatusLineReason(w io.Writer, statusCode StatusCode, reason string) error {
+	return writeStatusLineReason(w, httpVersion, statusCode, reason)
+}
 
-type ReasonPhrase string
+func writeStatusLine(w io.Writer, version string, statusCode StatusCode) error {
+	return writeStatusLineReason(w, version, statusCode, StatusText(statusCode))
+}
 
-const (
-	ReasonOk                  ReasonPhrase = "OK"
-	ReasonBadRequest          ReasonPhrase = "Bad Request"
-	ReasonInternalServerError ReasonPhrase = "Internal Server Error"
-)
+func writeStatusLineReason(w io.Writer, version string, statusCode StatusCode, reason string) error {
+	if !statusCode.Valid() {
+		return fmt.Errorf("invalid status code: %d", statusCode)
+	}
+	if !validReason(reason) {
+		return fmt.Errorf("invalid reason phrase: %q", reason)
+	}
+	// the space after the code stays even when the reason is empty
+	_, err := fmt.Fprintf(w, "HTTP/%s %d %s\r\n", version, statusCode, reason)
+	return err
+}
 
-func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	format := "HTTP/%s %d %s\r\n"
-	switch statusCode {
-	case Ok:
-		_, err := io.WriteString(w, fmt.Sprintf(format, httpVersion, statusCode, ReasonOk))
-		return err
-	case BadRequest:
-		_, err := io.WriteString(w, fmt.Sprintf(format, httpVersion, statusCode, ReasonBadRequest))
-		return err
-	case InternalServerError:
-		_, err := io.WriteString(w, fmt.Sprintf(format, httpVersion, statusCode, ReasonInternalServerError))
-		return err
-	default:
-		return fmt.Errorf("Unrecognized status code: %d", statusCode)
+// validReason reports whether s only holds the HTAB, SP, VCHAR and obs-text
+// a reason phrase may contain.
+func validReason(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
 	}
+	return true
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
-	h.Set("content-length", fmt.Sprintf("%d", contentLen))
-	h.Set("connection", "close")
+	h.SetContentLength(int64(contentLen))
 	h.Set("content-type", "text/plain")
 	return h
 }
 
-func WriteHeaders(w io.Writer, headers headers.Headers) error {
-	for key, val := range headers {
+func WriteHeaders(w io.Writer, headers *headers.Headers) error {
+	for key, val := range headers.All() {
 		if _, err := io.WriteString(w, fmt.Sprintf("%s: %s\r\n", key, val)); err != nil {
 			return err
 		}
@@ -0,0 +1,344 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered status code
+	var b bytes.Buffer
+	err := WriteStatusLine(&b, NotFound)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", b.String())
+
+	// Test: Unregistered status code keeps the space before the empty reason
+	b.Reset()
+	err = WriteStatusLine(&b, StatusCode(599))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 599 \r\n", b.String())
+
+	// Test: Custom reason phrase
+	b.Reset()
+	err = WriteStatusLineReason(&b, Found, "Over There")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 302 Over There\r\n", b.String())
+
+	// Test: Not a three-digit code
+	b.Reset()
+	err = WriteStatusLine(&b, StatusCode(99))
+	require.Error(t, err)
+	err = WriteStatusLine(&b, StatusCode(1000))
+	require.Error(t, err)
+	assert.Empty(t, b.String())
+
+	// Test: Reason phrase with a line break
+	err = WriteStatusLineReason(&b, Ok, "OK\r\nSet-Cookie: x=1")
+	require.Error(t, err)
+	assert.Empty(t, b.String())
+}
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "OK", StatusText(Ok))
+	assert.Equal(t, "Early Hints", StatusText(EarlyHints))
+	assert.Equal(t, "Permanent Redirect", StatusText(PermanentRedirect))
+	assert.Equal(t, "Unavailable For Legal Reasons", StatusText(UnavailableForLegalReasons))
+	assert.Equal(t, "Network Authentication Required", StatusText(NetworkAuthenticationRequired))
+	assert.Equal(t, "", StatusText(StatusCode(418)))
+
+	assert.True(t, Continue.IsInformational())
+	assert.True(t, NoContent.IsSuccess())
+	assert.True(t, NotModified.IsRedirect())
+	assert.False(t, NotModified.IsError())
+	assert.True(t, NotFound.IsClientError())
+	assert.True(t, NotFound.IsError())
+	assert.True(t, BadGateway.IsServerError())
+	assert.True(t, BadGateway.IsError())
+	assert.False(t, Ok.IsError())
+	assert.True(t, StatusCode(799).Valid())
+	assert.False(t, StatusCode(42).Valid())
+}
+
+func TestWriter(t *testing.T) {
+	// Test: Calls in order
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	assert.Equal(t, StateStatusLine, w.State())
+	require.NoError(t, w.WriteStatusLine(Ok))
+	assert.Equal(t, Ok, w.Status())
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hel"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = w.WriteBody([]byte("lo"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), w.BytesWritten())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, StateDone, w.State())
+	assert.Contains(t, b.String(), "HTTP/1.1 200 OK\r\n")
+	assert.True(t, bytes.HasSuffix(b.Bytes(), []byte("\r\n\r\nhello")))
+	val, _ := w.Header().Get("Content-Length")
+	assert.Equal(t, "5", val)
+
+	// Test: Wrappers are unwrapped
+	assert.Same(t, w, NewWriter(w))
+	assert.Same(t, w, NewWriter(wrapper{w}))
+
+	// Test: Body before headers
+	b.Reset()
+	w = NewWriter(&b)
+	_, err = w.WriteBody([]byte("hello"))
+	var stateErr *StateError
+	require.ErrorAs(t, err, &stateErr)
+	assert.Equal(t, "WriteBody", stateErr.Op)
+	assert.Equal(t, StateStatusLine, stateErr.State)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorAs(t, err, &stateErr)
+	assert.Equal(t, StateHeaders, stateErr.State)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", b.String())
+
+	// Test: Status line twice
+	err = w.WriteStatusLine(NotFound)
+	require.ErrorAs(t, err, &stateErr)
+	assert.Equal(t, Ok, w.Status())
+
+	// Test: Informational status as the final response
+	w = NewWriter(&b)
+	require.Error(t, w.WriteStatusLine(Continue))
+	assert.Equal(t, StateStatusLine, w.State())
+
+	// Test: Body longer than Content-Length
+	b.Reset()
+	w = NewWriter(&b)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyOverflow)
+	assert.Equal(t, int64(0), w.BytesWritten())
+
+	// Test: Body shorter than Content-Length closes the connection
+	w.SetKeepAlive(true)
+	_, err = w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Finish(), ErrShortBody)
+	assert.False(t, w.KeepAlive())
+
+	// Test: Finish ends a chunked body
+	b.Reset()
+	w = NewWriter(&b)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	h := headers.NewHeaders()
+	h.Set("transfer-encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte(" world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), w.BytesWritten())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, bytes.HasSuffix(b.Bytes(), []byte("\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n")))
+
+	// Test: Nothing after the trailers
+	require.NoError(t, w.Finish())
+	err = w.WriteTrailers(headers.NewHeaders())
+	require.ErrorAs(t, err, &stateErr)
+	assert.Equal(t, StateDone, stateErr.State)
+
+	// Test: Finish with nothing written sends an empty 200
+	b.Reset()
+	w = NewWriter(&b)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", b.String())
+
+	// Test: Informational response after the final status line
+	err = w.WriteInformational(EarlyHints, nil)
+	require.ErrorAs(t, err, &stateErr)
+}
+
+// splitResponse splits a written response at the end of its header section.
+func splitResponse(t *testing.T, b *bytes.Buffer) (string, string) {
+	t.Helper()
+	head, body, ok := strings.Cut(b.String(), "\r\n\r\n")
+	require.True(t, ok)
+	return head + "\r\n", body
+}
+
+func TestFraming(t *testing.T) {
+	newWriter := func(b *bytes.Buffer, version, method string) *Writer {
+		w := NewWriter(b)
+		w.SetVersion(version)
+		w.SetMethod(method)
+		w.SetKeepAlive(true)
+		return w
+	}
+	contentType := func() *headers.Headers {
+		h := headers.NewHeaders()
+		h.Set("content-type", "text/plain")
+		return h
+	}
+
+	// Test: Single write gets a Content-Length
+	var b bytes.Buffer
+	w := newWriter(&b, "1.1", "GET")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(contentType()))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Empty(t, b.String()[len("HTTP/1.1 200 OK\r\n"):])
+	require.NoError(t, w.Finish())
+	head, body := splitResponse(t, &b)
+	assert.Contains(t, head, "Content-Length: 5\r\n")
+	assert.NotContains(t, head, "Transfer-Encoding")
+	assert.Equal(t, "hello", body)
+	assert.True(t, w.KeepAlive())
+
+	// Test: Streaming on HTTP/1.1 is chunked
+	b.Reset()
+	w = newWriter(&b, "1.1", "GET")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(contentType()))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, &b)
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.NotContains(t, head, "Content-Length")
+	assert.Equal(t, "5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n", body)
+	assert.True(t, w.KeepAlive())
+
+	// Test: Flushing commits to streaming
+	b.Reset()
+	w = newWriter(&b, "1.1", "GET")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(contentType()))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, &b)
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Equal(t, "5\r\nhello\r\n0\r\n\r\n", body)
+
+	// Test: Streaming on HTTP/1.0 is delimited by closing the connection
+	b.Reset()
+	w = newWriter(&b, "1.0", "GET")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(contentType()))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, &b)
+	assert.NotContains(t, head, "Transfer-Encoding")
+	assert.NotContains(t, head, "Content-Length")
+	assert.Contains(t, head, "Connection: close\r\n")
+	assert.Equal(t, "hello world", body)
+	assert.False(t, w.KeepAlive())
+
+	// Test: HEAD gets the length but not the body
+	b.Reset()
+	w = newWriter(&b, "1.1", "HEAD")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(contentType()))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, &b)
+	assert.Contains(t, head, "Content-Length: 5\r\n")
+	assert.Empty(t, body)
+	assert.Equal(t, int64(5), w.BytesWritten())
+	assert.True(t, w.KeepAlive())
+
+	// Test: HEAD with a declared length and no body
+	b.Reset()
+	w = newWriter(&b, "1.1", "HEAD")
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(42)))
+	require.NoError(t, w.Finish())
+	head, body = splitResponse(t, &b)
+	assert.Contains(t, head, "Content-Length: 42\r\n")
+	assert.Empty(t, body)
+	assert.True(t, w.KeepAlive())
+
+	// Test: 204 and 304 have no body
+	for _, code := range []StatusCode{NoContent, NotModified} {
+		b.Reset()
+		w = newWriter(&b, "1.1", "GET")
+		require.NoError(t, w.WriteStatusLine(code))
+		h := contentType()
+		h.Set("transfer-encoding", "chunked")
+		require.NoError(t, w.WriteHeaders(h))
+		_, err = w.WriteBody([]byte("hello"))
+		require.ErrorIs(t, err, ErrBodyNotAllowed)
+		require.NoError(t, w.Finish())
+		head, body = splitResponse(t, &b)
+		assert.NotContains(t, head, "Transfer-Encoding")
+		assert.NotContains(t, head, "Content-Length")
+		assert.Empty(t, body)
+		assert.True(t, w.KeepAlive())
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	var b bytes.Buffer
+	h := headers.NewHeaders()
+	h.Set("content-type", "text/html")
+	h.Set("x-request-id", "42")
+	h.SetExact("x-legacy-ID", "7")
+	h.Set("content-length", "0")
+	require.NoError(t, WriteHeaders(&b, h))
+	assert.Equal(t, "Content-Type: text/html\r\nX-Request-Id: 42\r\nx-legacy-ID: 7\r\nContent-Length: 0\r\n\r\n", b.String())
+
+	// Test: A nil header section still gets framed and sent
+	b.Reset()
+	w := NewWriter(&b)
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(nil))
+	_, err := w.WriteBody([]byte("hi"))
+	require.NoError(t, err)
+	// the first write is held back to measure the body
+	assert.False(t, w.HeadersSent())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.HeadersSent())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nhi", b.String())
+}
+
+func TestWrite(t *testing.T) {
+	// Test: Writing first implies a 200 with default headers
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	_, err := fmt.Fprintf(w, "hello %s", "world")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 11\r\nConnection: close\r\n\r\nhello world", b.String())
+
+	// Test: After a bare status line the header section is empty
+	b.Reset()
+	w = NewWriter(&b)
+	require.NoError(t, w.WriteStatusLine(Created))
+	_, err = fmt.Fprint(w, "made")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 201 Created\r\nContent-Length: 4\r\nConnection: close\r\n\r\nmade", b.String())
+}
+
+type wrapper struct {
+	*Writer
+}
+
+func (w wrapper) Unwrap() *Writer {
+	return w.Writer
+}
@@ -0,0 +1,247 @@
+package response
+
+type StatusCode int
+
+// Status codes from the IANA HTTP Status Code Registry.
+const (
+	Continue           StatusCode = 100
+	SwitchingProtocols StatusCode = 101
+	Processing         StatusCode = 102
+	EarlyHints         StatusCode = 103
+
+	Ok                   StatusCode = 200
+	Created              StatusCode = 201
+	Accepted             StatusCode = 202
+	NonAuthoritativeInfo StatusCode = 203
+	NoContent            StatusCode = 204
+	ResetContent         StatusCode = 205
+	PartialContent       StatusCode = 206
+	MultiStatus          StatusCode = 207
+	AlreadyReported      StatusCode = 208
+	IMUsed               StatusCode = 226
+
+	MultipleChoices   StatusCode = 300
+	MovedPermanently  StatusCode = 301
+	Found             StatusCode = 302
+	SeeOther          StatusCode = 303
+	NotModified       StatusCode = 304
+	UseProxy          StatusCode = 305
+	TemporaryRedirect StatusCode = 307
+	PermanentRedirect StatusCode = 308
+
+	BadRequest                  StatusCode = 400
+	Unauthorized                StatusCode = 401
+	PaymentRequired             StatusCode = 402
+	Forbidden                   StatusCode = 403
+	NotFound                    StatusCode = 404
+	MethodNotAllowed            StatusCode = 405
+	NotAcceptable               StatusCode = 406
+	ProxyAuthRequired           StatusCode = 407
+	RequestTimeout              StatusCode = 408
+	Conflict                    StatusCode = 409
+	Gone                        StatusCode = 410
+	LengthRequired              StatusCode = 411
+	PreconditionFailed          StatusCode = 412
+	ContentTooLarge             StatusCode = 413
+	URITooLong                  StatusCode = 414
+	UnsupportedMediaType        StatusCode = 415
+	RangeNotSatisfiable         StatusCode = 416
+	ExpectationFailed           StatusCode = 417
+	MisdirectedRequest          StatusCode = 421
+	UnprocessableContent        StatusCode = 422
+	Locked                      StatusCode = 423
+	FailedDependency            StatusCode = 424
+	TooEarly                    StatusCode = 425
+	UpgradeRequired             StatusCode = 426
+	PreconditionRequired        StatusCode = 428
+	TooManyRequests             StatusCode = 429
+	RequestHeaderFieldsTooLarge StatusCode = 431
+	UnavailableForLegalReasons  StatusCode = 451
+
+	InternalServerError           StatusCode = 500
+	NotImplemented                StatusCode = 501
+	BadGateway                    StatusCode = 502
+	ServiceUnavailable            StatusCode = 503
+	GatewayTimeout                StatusCode = 504
+	HTTPVersionNotSupported       StatusCode = 505
+	VariantAlsoNegotiates         StatusCode = 506
+	InsufficientStorage           StatusCode = 507
+	LoopDetected                  StatusCode = 508
+	NotExtended                   StatusCode = 510
+	NetworkAuthenticationRequired StatusCode = 511
+)
+
+type ReasonPhrase string
+
+// Reason phrases from the IANA HTTP Status Code Registry.
+const (
+	ReasonContinue           ReasonPhrase = "Continue"
+	ReasonSwitchingProtocols ReasonPhrase = "Switching Protocols"
+	ReasonProcessing         ReasonPhrase = "Processing"
+	ReasonEarlyHints         ReasonPhrase = "Early Hints"
+
+	ReasonOk                   ReasonPhrase = "OK"
+	ReasonCreated              ReasonPhrase = "Created"
+	ReasonAccepted             ReasonPhrase = "Accepted"
+	ReasonNonAuthoritativeInfo ReasonPhrase = "Non-Authoritative Information"
+	ReasonNoContent            ReasonPhrase = "No Content"
+	ReasonResetContent         ReasonPhrase = "Reset Content"
+	ReasonPartialContent       ReasonPhrase = "Partial Content"
+	ReasonMultiStatus          ReasonPhrase = "Multi-Status"
+	ReasonAlreadyReported      ReasonPhrase = "Already Reported"
+	ReasonIMUsed               ReasonPhrase = "IM Used"
+
+	ReasonMultipleChoices   ReasonPhrase = "Multiple Choices"
+	ReasonMovedPermanently  ReasonPhrase = "Moved Permanently"
+	ReasonFound             ReasonPhrase = "Found"
+	ReasonSeeOther          ReasonPhrase = "See Other"
+	ReasonNotModified       ReasonPhrase = "Not Modified"
+	ReasonUseProxy          ReasonPhrase = "Use Proxy"
+	ReasonTemporaryRedirect ReasonPhrase = "Temporary Redirect"
+	ReasonPermanentRedirect ReasonPhrase = "Permanent Redirect"
+
+	ReasonBadRequest                  ReasonPhrase = "Bad Request"
+	ReasonUnauthorized                ReasonPhrase = "Unauthorized"
+	ReasonPaymentRequired             ReasonPhrase = "Payment Required"
+	ReasonForbidden                   ReasonPhrase = "Forbidden"
+	ReasonNotFound                    ReasonPhrase = "Not Found"
+	ReasonMethodNotAllowed            ReasonPhrase = "Method Not Allowed"
+	ReasonNotAcceptable               ReasonPhrase = "Not Acceptable"
+	ReasonProxyAuthRequired           ReasonPhrase = "Proxy Authentication Required"
+	ReasonRequestTimeout              ReasonPhrase = "Request Timeout"
+	ReasonConflict                    ReasonPhrase = "Conflict"
+	ReasonGone                        ReasonPhrase = "Gone"
+	ReasonLengthRequired              ReasonPhrase = "Length Required"
+	ReasonPreconditionFailed          ReasonPhrase = "Precondition Failed"
+	ReasonContentTooLarge             ReasonPhrase = "Content Too Large"
+	ReasonURITooLong                  ReasonPhrase = "URI Too Long"
+	ReasonUnsupportedMediaType        ReasonPhrase = "Unsupported Media Type"
+	ReasonRangeNotSatisfiable         ReasonPhrase = "Range Not Satisfiable"
+	ReasonExpectationFailed           ReasonPhrase = "Expectation Failed"
+	ReasonMisdirectedRequest          ReasonPhrase = "Misdirected Request"
+	ReasonUnprocessableContent        ReasonPhrase = "Unprocessable Content"
+	ReasonLocked                      ReasonPhrase = "Locked"
+	ReasonFailedDependency            ReasonPhrase = "Failed Dependency"
+	ReasonTooEarly                    ReasonPhrase = "Too Early"
+	ReasonUpgradeRequired             ReasonPhrase = "Upgrade Required"
+	ReasonPreconditionRequired        ReasonPhrase = "Precondition Required"
+	ReasonTooManyRequests             ReasonPhrase = "Too Many Requests"
+	ReasonRequestHeaderFieldsTooLarge ReasonPhrase = "Request Header Fields Too Large"
+	ReasonUnavailableForLegalReasons  ReasonPhrase = "Unavailable For Legal Reasons"
+
+	ReasonInternalServerError           ReasonPhrase = "Internal Server Error"
+	ReasonNotImplemented                ReasonPhrase = "Not Implemented"
+	ReasonBadGateway                    ReasonPhrase = "Bad Gateway"
+	ReasonServiceUnavailable            ReasonPhrase = "Service Unavailable"
+	ReasonGatewayTimeout                ReasonPhrase = "Gateway Timeout"
+	ReasonHTTPVersionNotSupported       ReasonPhrase = "HTTP Version Not Supported"
+	ReasonVariantAlsoNegotiates         ReasonPhrase = "Variant Also Negotiates"
+	ReasonInsufficientStorage           ReasonPhrase = "Insufficient Storage"
+	ReasonLoopDetected                  ReasonPhrase = "Loop Detected"
+	ReasonNotExtended                   ReasonPhrase = "Not Extended"
+	ReasonNetworkAuthenticationRequired ReasonPhrase = "Network Authentication Required"
+)
+
+var statusText = map[StatusCode]ReasonPhrase{
+	Continue:           ReasonContinue,
+	SwitchingProtocols: ReasonSwitchingProtocols,
+	Processing:         ReasonProcessing,
+	EarlyHints:         ReasonEarlyHints,
+
+	Ok:                   ReasonOk,
+	Created:              ReasonCreated,
+	Accepted:             ReasonAccepted,
+	NonAuthoritativeInfo: ReasonNonAuthoritativeInfo,
+	NoContent:            ReasonNoContent,
+	ResetContent:         ReasonResetContent,
+	PartialContent:       ReasonPartialContent,
+	MultiStatus:          ReasonMultiStatus,
+	AlreadyReported:      ReasonAlreadyReported,
+	IMUsed:               ReasonIMUsed,
+
+	MultipleChoices:   ReasonMultipleChoices,
+	MovedPermanently:  ReasonMovedPermanently,
+	Found:             ReasonFound,
+	SeeOther:          ReasonSeeOther,
+	NotModified:       ReasonNotModified,
+	UseProxy:          ReasonUseProxy,
+	TemporaryRedirect: ReasonTemporaryRedirect,
+	PermanentRedirect: ReasonPermanentRedirect,
+
+	BadRequest:                  ReasonBadRequest,
+	Unauthorized:                ReasonUnauthorized,
+	PaymentRequired:             ReasonPaymentRequired,
+	Forbidden:                   ReasonForbidden,
+	NotFound:                    ReasonNotFound,
+	MethodNotAllowed:            ReasonMethodNotAllowed,
+	NotAcceptable:               ReasonNotAcceptable,
+	ProxyAuthRequired:           ReasonProxyAuthRequired,
+	RequestTimeout:              ReasonRequestTimeout,
+	Conflict:                    ReasonConflict,
+	Gone:                        ReasonGone,
+	LengthRequired:              ReasonLengthRequired,
+	PreconditionFailed:          ReasonPreconditionFailed,
+	ContentTooLarge:             ReasonContentTooLarge,
+	URITooLong:                  ReasonURITooLong,
+	UnsupportedMediaType:        ReasonUnsupportedMediaType,
+	RangeNotSatisfiable:         ReasonRangeNotSatisfiable,
+	ExpectationFailed:           ReasonExpectationFailed,
+	MisdirectedRequest:          ReasonMisdirectedRequest,
+	UnprocessableContent:        ReasonUnprocessableContent,
+	Locked:                      ReasonLocked,
+	FailedDependency:            ReasonFailedDependency,
+	TooEarly:                    ReasonTooEarly,
+	UpgradeRequired:             ReasonUpgradeRequired,
+	PreconditionRequired:        ReasonPreconditionRequired,
+	TooManyRequests:             ReasonTooManyRequests,
+	RequestHeaderFieldsTooLarge: ReasonRequestHeaderFieldsTooLarge,
+	UnavailableForLegalReasons:  ReasonUnavailableForLegalReasons,
+
+	InternalServerError:           ReasonInternalServerError,
+	NotImplemented:                ReasonNotImplemented,
+	BadGateway:                    ReasonBadGateway,
+	ServiceUnavailable:            ReasonServiceUnavailable,
+	GatewayTimeout:                ReasonGatewayTimeout,
+	HTTPVersionNotSupported:       ReasonHTTPVersionNotSupported,
+	VariantAlsoNegotiates:         ReasonVariantAlsoNegotiates,
+	InsufficientStorage:           ReasonInsufficientStorage,
+	LoopDetected:                  ReasonLoopDetected,
+	NotExtended:                   ReasonNotExtended,
+	NetworkAuthenticationRequired: ReasonNetworkAuthenticationRequired,
+}
+
+// StatusText returns the registered reason phrase for code, or "" if the
+// code is unregistered.
+func StatusText(code StatusCode) string {
+	return string(statusText[code])
+}
+
+// Valid reports whether c is a three-digit status code, registered or not.
+func (c StatusCode) Valid() bool {
+	return c >= 100 && c <= 999
+}
+
+func (c StatusCode) IsInformational() bool {
+	return c >= 100 && c <= 199
+}
+
+func (c StatusCode) IsSuccess() bool {
+	return c >= 200 && c <= 299
+}
+
+func (c StatusCode) IsRedirect() bool {
+	return c >= 300 && c <= 399
+}
+
+func (c StatusCode) IsClientError() bool {
+	return c >= 400 && c <= 499
+}
+
+func (c StatusCode) IsServerError() bool {
+	return c >= 500 && c <= 599
+}
+
+// IsError reports whether c is a client or server error.
+func (c StatusCode) IsError() bool {
+	return c.IsClientError() || c.IsServerError()
+}
@@ -0,0 +1,495 @@
+package response
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/httpfromtcp/internal/headers"
+)
+
+// WriterState is how far a Writer has got through a response. A response is
+// written in order: status line, headers, body, and for chunked bodies an
+// optional trailer section.
+type WriterState int
+
+const (
+	StateStatusLine WriterState = iota // nothing but 1xx responses sent yet
+	StateHeaders                       // status line sent
+	StateBody                          // header section sent
+	StateDone                          // response complete
+)
+
+func (s WriterState) String() string {
+	switch s {
+	case StateStatusLine:
+		return "awaiting status line"
+	case StateHeaders:
+		return "awaiting headers"
+	case StateBody:
+		return "writing body"
+	case StateDone:
+		return "done"
+	default:
+		return fmt.Sprintf("WriterState(%d)", int(s))
+	}
+}
+
+// framing is how the end of a response body is marked.
+type framing int
+
+const (
+	framingAuto framing = iota // not settled until the body is written
+	framingLength
+	framingChunked
+	framingClose
+	framingNone // the response has no body
+)
+
+type Writer struct {
+	w         io.Writer
+	conn      net.Conn
+	version   string
+	head      bool
+	keepAlive bool
+	state     WriterState
+	status    StatusCode
+
+	// header is the header section until it is sent, along with the first
+	// write of the body in buf.
+	header   *headers.Headers
+	sent     *headers.Headers
+	buf      []byte
+	buffered bool
+	framing  framing
+	// contentLength is the length the body is framed with, or -1.
+	contentLength int64
+	written       int64
+}
+
+// NewWriter wraps w in a response Writer. If w already is a Writer, such as
+// the one the server hands to handlers, it is returned unchanged so the
+// server keeps track of what the handler wrote. So is the Writer inside a
+// wrapper with an Unwrap method, like the ones middleware hands on.
+func NewWriter(w io.Writer) *Writer {
+	switch rw := w.(type) {
+	case *Writer:
+		return rw
+	case interface{ Unwrap() *Writer }:
+		return rw.Unwrap()
+	}
+	return &Writer{w: w, version: httpVersion, contentLength: -1}
+}
+
+// SetVersion sets the HTTP-version of the request being answered. Responses
+// to HTTP/1.0 requests echo it in the status line and never use chunked
+// transfer coding.
+func (w *Writer) SetVersion(version string) {
+	w.version = version
+}
+
+// SetMethod sets the method of the request being answered. The body of a
+// response to HEAD is never sent, though its length is still reported.
+func (w *Writer) SetMethod(method string) {
+	w.head = method == "HEAD"
+}
+
+// SetKeepAlive tells the writer whether the connection may be reused after
+// this response. WriteHeaders adds "connection: close" when it may not.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetConn sets the connection the response goes out on, for the deadline
+// methods.
+func (w *Writer) SetConn(conn net.Conn) {
+	w.conn = conn
+}
+
+// SetReadDeadline overrides the server's read deadline for the rest of this
+// request, such as for a long upload. The zero time means no deadline.
+func (w *Writer) SetReadDeadline(t time.Time) error {
+	if w.conn == nil {
+		return ErrDeadlineNotSupported
+	}
+	return w.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline overrides the server's write deadline for the rest of
+// this response, such as for a long stream. The zero time means no
+// deadline.
+func (w *Writer) SetWriteDeadline(t time.Time) error {
+	if w.conn == nil {
+		return ErrDeadlineNotSupported
+	}
+	return w.conn.SetWriteDeadline(t)
+}
+
+// KeepAlive reports whether the connection can carry another request once
+// this response is complete.
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive
+}
+
+func (w *Writer) State() WriterState {
+	return w.state
+}
+
+// Status returns the status code of the final response, or 0 if its status
+// line hasn't been written.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// StatusWritten reports whether the status line of the final response has
+// been written.
+func (w *Writer) StatusWritten() bool {
+	return w.state > StateStatusLine
+}
+
+// HeadersSent reports whether the header section has been written out,
+// which happens along with the start of the body. Until then nothing but
+// the status line has been written, and the response can still be
+// replaced by discarding it.
+func (w *Writer) HeadersSent() bool {
+	return w.state >= StateBody && w.header == nil
+}
+
+// Header returns the header section given to WriteHeaders, with the
+// framing and connection fields the writer adds once it has been sent. It
+// is nil before WriteHeaders.
+func (w *Writer) Header() *headers.Headers {
+	return w.sent
+}
+
+// BytesWritten returns how many bytes of body have been written, not
+// counting chunked framing.
+func (w *Writer) BytesWritten() int64 {
+	return w.written
+}
+
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase,
+// which may be empty.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
+	if w.state != StateStatusLine {
+		return &StateError{Op: "WriteStatusLine", State: w.state}
+	}
+	if statusCode.IsInformational() && statusCode != SwitchingProtocols {
+		return fmt.Errorf("informational status %d is not a final response", statusCode)
+	}
+	if err := writeStatusLineReason(w.w, w.version, statusCode, reason); err != nil {
+		return err
+	}
+	w.state = StateHeaders
+	w.status = statusCode
+	return nil
+}
+
+// WriteInformational sends an interim 1xx response, such as 100 Continue or
+// 103 Early Hints, ahead of the final response and flushes it to the client.
+// HTTP/1.0 clients don't understand them, so nothing is sent to them.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.state != StateStatusLine {
+		return &StateError{Op: "WriteInformational", State: w.state}
+	}
+	if !statusCode.IsInformational() || statusCode == SwitchingProtocols {
+		return fmt.Errorf("not an informational status code: %d", statusCode)
+	}
+	if w.version == "1.0" {
+		return nil
+	}
+
+	if err := writeStatusLine(w.w, w.version, statusCode); err != nil {
+		return err
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	if err := WriteHeaders(w.w, h); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Flush sends anything buffered below the writer on to the client. Once
+// the body has started, flushing commits the headers, so a body without a
+// Content-Length is streamed rather than measured.
+func (w *Writer) Flush() error {
+	if w.state == StateBody && w.header != nil {
+		if err := w.writeHeader(false); err != nil {
+			return err
+		}
+	}
+	if f, ok := w.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// WriteHeaders sets the header section of the response. It is sent along
+// with the start of the body, once the writer knows how to frame it: with
+// the Content-Length h declares, or else with one computed from a body
+// written in one go, or else chunked, or, for HTTP/1.0, by closing the
+// connection. Framing fields are dropped from responses that can't have a
+// body. A nil h is an empty header section.
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if w.state != StateHeaders {
+		return &StateError{Op: "WriteHeaders", State: w.state}
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	codings, err := h.TransferEncoding()
+	if err != nil {
+		return err
+	}
+	chunked := len(codings) > 0 && codings[len(codings)-1] == "chunked"
+
+	contentLength := int64(-1)
+	if !chunked {
+		if contentLength, err = h.ContentLength(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case w.status.IsInformational() || w.status == NoContent || w.status == NotModified:
+		// a 304 may still describe the representation it stands for
+		h.Del("transfer-encoding")
+		h.Del("trailer")
+		if w.status != NotModified {
+			h.Del("content-length")
+		}
+		w.framing = framingNone
+	case chunked && w.version == "1.0":
+		// HTTP/1.0 has no chunked coding, so the body goes out as is and
+		// closing the connection marks its end
+		h.Del("transfer-encoding")
+		h.Del("trailer")
+		h.Del("content-length")
+		w.framing = framingClose
+	case chunked:
+		// a length alongside chunked coding is never to be trusted
+		h.Del("content-length")
+		w.framing = framingChunked
+	case contentLength >= 0:
+		w.framing = framingLength
+		w.contentLength = contentLength
+	default:
+		w.framing = framingAuto
+	}
+
+	w.header = h
+	w.sent = h
+	w.state = StateBody
+	return nil
+}
+
+// writeHeader settles the framing of the body and sends the header section
+// along with any body buffered so far. final means the body is complete.
+func (w *Writer) writeHeader(final bool) error {
+	h := w.header
+	w.header = nil
+
+	if w.framing == framingAuto {
+		switch {
+		case final && !h.Has("trailer"):
+			// a HEAD handler that wrote nothing doesn't know the length
+			if !w.head || w.written > 0 {
+				if err := h.SetContentLength(w.written); err != nil {
+					return err
+				}
+			}
+			w.framing = framingLength
+			w.contentLength = w.written
+		case w.version == "1.0":
+			h.Del("trailer")
+			w.framing = framingClose
+		default:
+			h.Set("transfer-encoding", "chunked")
+			w.framing = framingChunked
+		}
+	}
+
+	// a body the client can't find the end of can only be delimited by
+	// closing the connection
+	if w.framing == framingClose && !w.head {
+		w.keepAlive = false
+	}
+
+	if h.HasConnectionOption("close") {
+		w.keepAlive = false
+	}
+	switch {
+	case !w.keepAlive:
+		h.Set("connection", "close")
+	case w.version == "1.0":
+		// persistence is opt-in for HTTP/1.0 and has to be confirmed
+		h.Set("connection", "keep-alive")
+	}
+
+	if err := WriteHeaders(w.w, h); err != nil {
+		return err
+	}
+	buf := w.buf
+	w.buf = nil
+	_, err := w.send(buf)
+	return err
+}
+
+// WriteBody writes p as the next part of the body. Writing past the
+// declared Content-Length fails with ErrBodyOverflow and writes nothing, as
+// does writing a body for a 204 or 304 response with ErrBodyNotAllowed. The
+// body of a response to HEAD is counted but never sent.
+func (w *Writer) WriteBody(p []byte) (int, error) {
+	if w.state != StateBody {
+		return 0, &StateError{Op: "WriteBody", State: w.state}
+	}
+	if w.framing == framingNone {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.contentLength >= 0 && w.written+int64(len(p)) > w.contentLength {
+		return 0, ErrBodyOverflow
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if w.header != nil {
+		// hold on to the first write in case it is the whole body
+		if w.framing == framingAuto && !w.buffered {
+			w.buffered = true
+			if !w.head {
+				w.buf = append([]byte(nil), p...)
+			}
+			w.written += int64(len(p))
+			return len(p), nil
+		}
+		if err := w.writeHeader(false); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.send(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Write makes a Writer an io.Writer. Like WriteBody it writes p as the next
+// part of the body, but when nothing has been written yet it first sends a
+// 200 with a text/plain Content-Type, and after a bare status line an empty
+// header section, so fmt.Fprintf and friends work straight away.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == StateStatusLine {
+		if err := w.WriteStatusLine(Ok); err != nil {
+			return 0, err
+		}
+		h := headers.NewHeaders()
+		h.Set("content-type", "text/plain")
+		if err := w.WriteHeaders(h); err != nil {
+			return 0, err
+		}
+	}
+	if w.state == StateHeaders {
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return 0, err
+		}
+	}
+	return w.WriteBody(p)
+}
+
+// WriteChunkedBody is WriteBody for handlers streaming a chunked body. When
+// the client can't take chunked coding the data is written as is.
+func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	return w.WriteBody(p)
+}
+
+// send writes body bytes framed the way the headers promised.
+func (w *Writer) send(p []byte) (int, error) {
+	if w.head || len(p) == 0 {
+		return len(p), nil
+	}
+	if w.framing != framingChunked {
+		return w.w.Write(p)
+	}
+	if _, err := fmt.Fprintf(w.w, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	_, err = io.WriteString(w.w, "\r\n")
+	return n, err
+}
+
+// WriteChunkedBodyDone ends the body without trailers.
+func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.state != StateBody {
+		return 0, &StateError{Op: "WriteChunkedBodyDone", State: w.state}
+	}
+	return 0, w.endBody(nil)
+}
+
+// WriteTrailers ends the body with the trailer section h. Trailers are
+// dropped when the body could not be sent chunked.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if w.state != StateBody {
+		return &StateError{Op: "WriteTrailers", State: w.state}
+	}
+	return w.endBody(h)
+}
+
+// endBody completes the body, with the last chunk and trailers if it is
+// chunked. A body shorter than its Content-Length leaves the client waiting
+// for the rest, so the connection can't be reused.
+func (w *Writer) endBody(trailers *headers.Headers) error {
+	if w.header != nil {
+		if err := w.writeHeader(true); err != nil {
+			return err
+		}
+	}
+	w.state = StateDone
+
+	if w.framing == framingChunked && !w.head {
+		if trailers == nil {
+			trailers = headers.NewHeaders()
+		}
+		if _, err := io.WriteString(w.w, "0\r\n"); err != nil {
+			return err
+		}
+		return WriteHeaders(w.w, trailers)
+	}
+	if w.framing == framingLength && !w.head && w.written < w.contentLength {
+		w.keepAlive = false
+		return ErrShortBody
+	}
+	return nil
+}
+
+// Finish completes whatever the handler left of the response: an empty 200
+// if nothing was written, an empty body after a bare status line, and the
+// end of the body otherwise. It is a no-op once the response is done.
+// ErrShortBody means the body fell short of its Content-Length.
+func (w *Writer) Finish() error {
+	if w.state == StateStatusLine {
+		if err := w.WriteStatusLine(Ok); err != nil {
+			return err
+		}
+	}
+	if w.state == StateHeaders {
+		if err := w.WriteHeaders(headers.NewHeaders()); err != nil {
+			return err
+		}
+	}
+	if w.state == StateBody {
+		return w.endBody(nil)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package router dispatches requests to handlers by method and path.
+//
+// Routes are registered with patterns like "GET /users/{id}", where the
+// method is optional and a route without one takes every method. A
+// {name} segment matches one path segment, and a trailing *name matches
+// the rest of the path, slashes included:
+//
+//	r := router.New()
+//	r.Handle("GET /users/{id}", showUser)
+//	r.Handle("/static/*path", serveFile)
+//	s := server.New(server.Config{Addr: ":8080", Handler: r.Handler()})
+//
+// The matched values are on Request.Params. When more than one route
+// matches a path, static text takes precedence over a parameter, and a
+// parameter over a wildcard.
+package router
+
+import (
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/httpfromtcp/internal/headers"
+	"github.com/httpfromtcp/internal/request"
+	"github.com/httpfromtcp/internal/response"
+	"github.com/httpfromtcp/internal/server"
+)
+
+type Router struct {
+	root node
+	// methods holds every method a route was registered for
+	methods []string
+
+	// NotFound handles requests no route matches. If it is nil they are
+	// answered with 404.
+	NotFound server.Handler
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers h for pattern. It panics if pattern is malformed or
+// already registered, if it names a method the server doesn't accept (see
+// request.Methods), or if it names a parameter differently from another
+// route at the same position.
+func (r *Router) Handle(pattern string, h server.Handler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	} else if !slices.Contains(request.Methods, method) {
+		// the server answers any other method with 405 before routing
+		panic("router: unsupported method in " + pattern)
+	}
+	path = strings.TrimLeft(path, " ")
+	if !strings.HasPrefix(path, "/") {
+		panic("router: path does not start with / in " + pattern)
+	}
+	if h == nil {
+		panic("router: nil handler for " + pattern)
+	}
+
+	r.root.insert(method, path, h)
+	if method != "" && !slices.Contains(r.methods, method) {
+		r.methods = append(r.methods, method)
+	}
+}
+
+// Handler returns the server.Handler that dispatches to the routes of r.
+//
+// A HEAD request is handled by the GET route when there is no HEAD one,
+// and an OPTIONS request without a route is answered with the methods the
+// target allows. A path that matches routes for other methods only is
+// answered with 405 and an Allow header.
+func (r *Router) Handler() server.Handler {
+	return r.serve
+}
+
+func (r *Router) serve(w io.Writer, req *request.Request) *server.HandlerError {
+	method := req.RequestLine.Method
+	if req.Target.Form == request.AsteriskForm {
+		// OPTIONS * asks about the server as a whole
+		return writeOptions(w, allowed(r.methods))
+	}
+
+	var (
+		h       server.Handler
+		params  []param
+		methods []string
+	)
+	r.root.match(req.Target.RawPath, nil, func(n *node, ps []param) bool {
+		for m := range n.handlers {
+			if !slices.Contains(methods, m) {
+				methods = append(methods, m)
+			}
+		}
+		if h == nil {
+			if h = n.lookup(method); h != nil {
+				params = slices.Clone(ps)
+			}
+		}
+		return false
+	})
+
+	switch {
+	case h != nil:
+		req.Params = make(map[string]string, len(params))
+		for _, p := range params {
+			// parameters are matched on the raw path so an escaped "/"
+			// stays inside its segment
+			if v, err := url.PathUnescape(p.value); err == nil {
+				p.value = v
+			}
+			req.Params[p.name] = p.value
+		}
+		return h(w, req)
+	case len(methods) == 0 && r.NotFound != nil:
+		return r.NotFound(w, req)
+	case len(methods) == 0:
+		return server.NewHandlerError(response.NotFound, "")
+	case method == "OPTIONS":
+		return writeOptions(w, allowed(methods))
+	default:
+		return server.NewHandlerError(response.MethodNotAllowed, "").WithAllow(allowed(methods)...)
+	}
+}
+
+// allowed returns the sorted methods for an Allow header, including the ones
+// the router answers itself.
+func allowed(methods []string) []string {
+	allow := slices.Clone(methods)
+	if slices.Contains(allow, "GET") && !slices.Contains(allow, "HEAD") {
+		allow = append(allow, "HEAD")
+	}
+	if !slices.Contains(allow, "OPTIONS") {
+		allow = append(allow, "OPTIONS")
+	}
+	slices.Sort(allow)
+	return allow
+}
+
+func writeOptions(w io.Writer, allow []string) *server.HandlerError {
+	rw := response.NewWriter(w)
+	h := headers.NewHeaders()
+	h.Set("allow", strings.Join(allow, ", "))
+	_ = rw.WriteStatusLine(response.NoContent)
+	_ = rw.WriteHeaders(h)
+	return nil
+}
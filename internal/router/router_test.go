@@ -0,0 +1,151 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/httpfromtcp/internal/request"
+	"github.com/httpfromtcp/internal/response"
+	"github.com/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs h on a request for method and target and returns the raw
+// response, the way the server would write it.
+func serve(t *testing.T, h server.Handler, method, target string) string {
+	t.Helper()
+	raw := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: localhost\r\n\r\n", method, target)
+	req, err := request.NewReader(strings.NewReader(raw)).ReadRequest()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	rw := response.NewWriter(&buf)
+	rw.SetMethod(method)
+	rw.SetKeepAlive(true)
+	if he := h(rw, req); he != nil {
+		he.Write(rw)
+	}
+	require.NoError(t, rw.Finish())
+	return buf.String()
+}
+
+// reply returns a handler that answers with the route name and the params
+// it matched.
+func reply(name string) server.Handler {
+	return func(w io.Writer, req *request.Request) *server.HandlerError {
+		body := name
+		for _, key := range []string{"id", "post", "path", "name"} {
+			if v, ok := req.Params[key]; ok {
+				body += fmt.Sprintf(" %s=%s", key, v)
+			}
+		}
+		rw := response.NewWriter(w)
+		_ = rw.WriteStatusLine(response.Ok)
+		_ = rw.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		_, _ = rw.WriteBody([]byte(body))
+		return nil
+	}
+}
+
+func body(resp string) string {
+	_, b, _ := strings.Cut(resp, "\r\n\r\n")
+	return b
+}
+
+func TestRouting(t *testing.T) {
+	r := New()
+	r.Handle("GET /", reply("root"))
+	r.Handle("GET /users", reply("users"))
+	r.Handle("POST /users", reply("create"))
+	r.Handle("GET /users/me", reply("me"))
+	r.Handle("GET /users/{id}", reply("user"))
+	r.Handle("DELETE /users/{id}", reply("delete"))
+	r.Handle("GET /users/{id}/posts/{post}", reply("post"))
+	r.Handle("GET /static/*path", reply("static"))
+	r.Handle("/any/{name}", reply("any"))
+	h := r.Handler()
+
+	// Test: Static routes, including ones sharing a prefix
+	assert.Equal(t, "root", body(serve(t, h, "GET", "/")))
+	assert.Equal(t, "users", body(serve(t, h, "GET", "/users")))
+	assert.Equal(t, "create", body(serve(t, h, "POST", "/users")))
+	assert.Equal(t, "me", body(serve(t, h, "GET", "/users/me")))
+
+	// Test: Parameters, with static text taking precedence
+	assert.Equal(t, "user id=42", body(serve(t, h, "GET", "/users/42")))
+	assert.Equal(t, "user id=mee", body(serve(t, h, "GET", "/users/mee")))
+	assert.Equal(t, "delete id=42", body(serve(t, h, "DELETE", "/users/42")))
+	assert.Equal(t, "post id=42 post=7", body(serve(t, h, "GET", "/users/42/posts/7")))
+	assert.Equal(t, "user id=a/b", body(serve(t, h, "GET", "/users/a%2Fb")))
+	assert.Equal(t, "user id=a b", body(serve(t, h, "GET", "/users/a%20b")))
+
+	// Test: Wildcards take the rest of the path
+	assert.Equal(t, "static path=css/site.css", body(serve(t, h, "GET", "/static/css/site.css")))
+	assert.Equal(t, "static path=", body(serve(t, h, "GET", "/static/")))
+
+	// Test: A route without a method takes any
+	assert.Equal(t, "any name=x", body(serve(t, h, "PATCH", "/any/x")))
+
+	// Test: 404
+	for _, target := range []string{"/nope", "/users/", "/users/42/posts", "/static", "/users/42/posts/7/x"} {
+		resp := serve(t, h, "GET", target)
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"), target)
+	}
+
+	// Test: 405 names the methods the path does take
+	resp := serve(t, h, "PUT", "/users/42")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "\r\nAllow: DELETE, GET, HEAD, OPTIONS\r\n")
+	resp = serve(t, h, "DELETE", "/users")
+	assert.Contains(t, resp, "\r\nAllow: GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: HEAD falls back to GET and sends no body
+	resp = serve(t, h, "HEAD", "/users/42")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "\r\nContent-Length: 10\r\n")
+	assert.Equal(t, "", body(resp))
+
+	// Test: Automatic OPTIONS
+	resp = serve(t, h, "OPTIONS", "/users")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 204 No Content\r\n"))
+	assert.Contains(t, resp, "\r\nAllow: GET, HEAD, OPTIONS, POST\r\n")
+	resp = serve(t, h, "OPTIONS", "*")
+	assert.Contains(t, resp, "\r\nAllow: DELETE, GET, HEAD, OPTIONS, POST\r\n")
+	assert.True(t, strings.HasPrefix(serve(t, h, "OPTIONS", "/nope"), "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Custom NotFound
+	r.NotFound = reply("missing")
+	assert.Equal(t, "missing", body(serve(t, h, "GET", "/nope")))
+}
+
+func TestHandlePanics(t *testing.T) {
+	noop := func(w io.Writer, req *request.Request) *server.HandlerError { return nil }
+	r := New()
+	r.Handle("GET /users/{id}", noop)
+	r.Handle("GET /files/*path", noop)
+
+	for _, pattern := range []string{
+		"users",
+		"GET users",
+		"G(T /users",
+		"PURGE /cache",
+		"get /users",
+		"GET /users/{id}",
+		"GET /users/{name}/posts",
+		"GET /files/*rest",
+		"GET /a{id}",
+		"GET /a/{id",
+		"GET /a/{id}x",
+		"GET /a/{}",
+		"GET /a/*",
+		"GET /a/*path/b",
+	} {
+		assert.Panics(t, func() { r.Handle(pattern, noop) }, pattern)
+	}
+	assert.Panics(t, func() { r.Handle("GET /b", nil) })
+	assert.NotPanics(t, func() { r.Handle("POST /users/{id}", noop) })
+}
@@ -0,0 +1,176 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/httpfromtcp/internal/server"
+)
+
+// node is a node of the radix tree routes are kept in. Its static children
+// start with distinct bytes, so at most one of them can match a path.
+type node struct {
+	prefix   string
+	children []*node
+
+	// param matches one non-empty path segment and wildcard the rest of
+	// the path; name is what the match is stored under on those nodes
+	param    *node
+	wildcard *node
+	name     string
+
+	// handlers holds the routes ending at this node by method, with ""
+	// for a route that takes any method
+	handlers map[string]server.Handler
+}
+
+type param struct {
+	name, value string
+}
+
+// insert adds the route for method at pattern, which has been checked to
+// start with "/".
+func (n *node) insert(method, pattern string, h server.Handler) {
+	for rest := pattern; ; {
+		i := strings.IndexAny(rest, "{*")
+		if i == -1 {
+			n = n.insertStatic(rest)
+			break
+		}
+		if i == 0 || rest[i-1] != '/' {
+			panic(fmt.Sprintf("router: parameter not at the start of a segment in %q", pattern))
+		}
+		n = n.insertStatic(rest[:i])
+		rest = rest[i:]
+
+		if rest[0] == '*' {
+			name := rest[1:]
+			if !validName(name) {
+				panic(fmt.Sprintf("router: invalid wildcard in %q", pattern))
+			}
+			n = n.child(&n.wildcard, name, pattern)
+			break
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end == -1 {
+			panic(fmt.Sprintf("router: unterminated parameter in %q", pattern))
+		}
+		name := rest[1:end]
+		rest = rest[end+1:]
+		if !validName(name) || rest != "" && rest[0] != '/' {
+			panic(fmt.Sprintf("router: invalid parameter in %q", pattern))
+		}
+		n = n.child(&n.param, name, pattern)
+	}
+
+	if n.handlers == nil {
+		n.handlers = map[string]server.Handler{}
+	}
+	if _, ok := n.handlers[method]; ok {
+		panic(fmt.Sprintf("router: %s %s registered twice", method, pattern))
+	}
+	n.handlers[method] = h
+}
+
+// child returns the param or wildcard node in slot, creating it if need
+// be. Routes sharing the node have to agree on its name.
+func (n *node) child(slot **node, name, pattern string) *node {
+	if *slot == nil {
+		*slot = &node{name: name}
+	} else if (*slot).name != name {
+		panic(fmt.Sprintf("router: %q conflicts with {%s} of an earlier route", pattern, (*slot).name))
+	}
+	return *slot
+}
+
+// insertStatic walks s down the static children of n, splitting nodes
+// where s leaves their prefix, and returns the node s ends at.
+func (n *node) insertStatic(s string) *node {
+	for s != "" {
+		c := n.static(s[0])
+		if c == nil {
+			c = &node{prefix: s}
+			n.children = append(n.children, c)
+			return c
+		}
+
+		l := 0
+		for l < len(s) && l < len(c.prefix) && s[l] == c.prefix[l] {
+			l++
+		}
+		if l < len(c.prefix) {
+			tail := *c
+			tail.prefix = c.prefix[l:]
+			*c = node{prefix: c.prefix[:l], children: []*node{&tail}}
+		}
+		n, s = c, s[l:]
+	}
+	return n
+}
+
+func (n *node) static(c byte) *node {
+	for _, child := range n.children {
+		if child.prefix[0] == c {
+			return child
+		}
+	}
+	return nil
+}
+
+// match calls fn for every node with routes that path leads to, most
+// specific first: static text wins over a parameter, which wins over a
+// wildcard. It stops once fn returns true. path is matched against what is
+// left after the prefix of n.
+func (n *node) match(path string, params []param, fn func(*node, []param) bool) bool {
+	if path == "" && n.handlers != nil && fn(n, params) {
+		return true
+	}
+	if path != "" {
+		if c := n.static(path[0]); c != nil && strings.HasPrefix(path, c.prefix) {
+			if c.match(path[len(c.prefix):], params, fn) {
+				return true
+			}
+		}
+	}
+	if n.param != nil {
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+		if end > 0 {
+			p := append(params, param{n.param.name, path[:end]})
+			if n.param.match(path[end:], p, fn) {
+				return true
+			}
+		}
+	}
+	if n.wildcard != nil {
+		return fn(n.wildcard, append(params, param{n.wildcard.name, path}))
+	}
+	return false
+}
+
+// lookup returns the handler of n for method.
+func (n *node) lookup(method string) server.Handler {
+	if h, ok := n.handlers[method]; ok {
+		return h
+	}
+	if h, ok := n.handlers["GET"]; ok && method == "HEAD" {
+		return h
+	}
+	return n.handlers[""]
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
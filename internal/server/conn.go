@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// newConnGrace is how long a connection that hasn't sent a byte yet is
+// given before Shutdown counts it as idle.
+const newConnGrace = 5 * time.Second
+
+type connState int
+
+const (
+	stateNew    connState = iota // accepted, nothing read yet
+	stateActive                  // in the middle of a request
+	stateIdle                    // waiting for the next request
+)
+
+// conn is a connection the server is serving, tracked for its timeouts and
+// for Shutdown.
+type conn struct {
+	net.Conn
+
+	// headerTimeout is how long a request has to send its header
+	// section once it starts to arrive
+	headerTimeout time.Duration
+
+	mu     sync.Mutex
+	state  connState
+	since  time.Time
+	closed bool
+}
+
+// activate marks c as in the middle of a request, which starts the clock
+// on its header section if it wasn't already.
+func (c *conn) activate() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	if c.state != stateActive {
+		c.start()
+	}
+	return true
+}
+
+// next starts the next request on c, which has already started to arrive.
+// Unlike activate it restarts the clock even if c is still active, and
+// drops any deadline the previous request left behind.
+func (c *conn) next() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.start()
+	return true
+}
+
+func (c *conn) start() {
+	c.state, c.since = stateActive, time.Now()
+	var deadline time.Time
+	if c.headerTimeout > 0 {
+		deadline = c.since.Add(c.headerTimeout)
+	}
+	_ = c.Conn.SetReadDeadline(deadline)
+}
+
+func (c *conn) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == stateActive
+}
+
+// started returns when the current request started to arrive.
+func (c *conn) started() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.since
+}
+
+// setDeadline sets a deadline d from now with set, or clears it if d isn't
+// positive.
+func (c *conn) setDeadline(set func(time.Time) error, d time.Duration) {
+	if d <= 0 {
+		_ = set(time.Time{})
+		return
+	}
+	_ = set(time.Now().Add(d))
+}
+
+func (c *conn) setState(state connState) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.state, c.since = state, time.Now()
+	return true
+}
+
+// closeIdle closes c if it isn't in the middle of a request.
+func (c *conn) closeIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == stateIdle || c.state == stateNew && time.Since(c.since) > newConnGrace {
+		c.closed = true
+		c.Conn.Close()
+	}
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.Conn.Close()
+}
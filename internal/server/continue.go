@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/httpfromtcp/internal/request"
+	"github.com/httpfromtcp/internal/response"
+)
+
+var errExpectationFailed = errors.New("unsupported expectation")
+
+// expectContinue arranges for the 100 Continue an HTTP/1.1 client asks for
+// with "Expect: 100-continue" to be sent the first time its body is read. A
+// handler that answers without reading the body therefore never invites it,
+// and the connection is closed afterwards since the client may or may not
+// send the body anyway. It reports whether the client is waiting for the
+// 100 Continue.
+func expectContinue(rw *response.Writer, req *request.Request) (bool, error) {
+	expect, ok := req.Headers.Get("Expect")
+	if !ok || req.RequestLine.HttpVersion == "1.0" {
+		return false, nil
+	}
+	if !strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return false, errExpectationFailed
+	}
+	if !req.BodyPending() {
+		return false, nil
+	}
+
+	req.BodyReader = &continueReader{
+		ReadCloser: req.BodyReader,
+		rw:         rw,
+		keepAlive:  rw.KeepAlive(),
+	}
+	rw.SetKeepAlive(false)
+	return true, nil
+}
+
+type continueReader struct {
+	io.ReadCloser
+	rw        *response.Writer
+	keepAlive bool
+	asked     bool
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if !c.asked {
+		c.asked = true
+		// once the final response has started it's too late to ask
+		if !c.rw.StatusWritten() {
+			if err := c.rw.WriteInformational(response.Continue, nil); err != nil {
+				return 0, err
+			}
+			c.rw.SetKeepAlive(c.keepAlive)
+		}
+	}
+	return c.ReadCloser.Read(p)
+}
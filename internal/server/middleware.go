@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io"
+
+	"github.com/httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler with behaviour shared across routes, such as
+// logging or authentication.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in mw, the first outermost: Chain(h, a, b) runs a, which
+// runs b, which runs h.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// ResponseObserver lets middleware see what the handlers it wraps sent: the
+// status, the header section and how many bytes of body. Handlers given an
+// observer write through the same response.Writer it wraps, so nothing
+// about the response changes.
+//
+// A HandlerError is only written once the whole chain has returned, so a
+// handler that returned one has left the observer without a status.
+type ResponseObserver struct {
+	*response.Writer
+}
+
+// Observe wraps w, which should be the writer the middleware was given.
+func Observe(w io.Writer) *ResponseObserver {
+	return &ResponseObserver{Writer: response.NewWriter(w)}
+}
+
+// Unwrap returns the response.Writer o wraps; response.NewWriter uses it so
+// handlers write to it directly.
+func (o *ResponseObserver) Unwrap() *response.Writer {
+	return o.Writer
+}
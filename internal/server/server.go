@@ -1,122 +1,615 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"log"
 	"net"
-	"sync/atomic"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/httpfromtcp/internal/headers"
 	"github.com/httpfromtcp/internal/request"
 	"github.com/httpfromtcp/internal/response"
 )
 
+const (
+	DefaultReadHeaderTimeout  = 10 * time.Second
+	DefaultIdleTimeout        = 60 * time.Second
+	DefaultMaxRequestsPerConn = 100
+)
+
+type Config struct {
+	// Addr is the address to listen on, such as ":8080", or
+	// "127.0.0.1:0" for a port picked by the system.
+	Addr string
+	// Network is the network Addr is on, "tcp" if empty.
+	Network string
+	Handler Handler
+	// TLSConfig, if set, serves HTTPS with it. It needs at least one
+	// certificate or a GetCertificate function.
+	TLSConfig *tls.Config
+
+	// ReadHeaderTimeout is how long a client has to send the header
+	// section of a request once it starts, or once it connects. Clients
+	// that take longer are answered with 408. Zero means
+	// DefaultReadHeaderTimeout, negative means no limit.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long a client has to send a whole request,
+	// body included, and WriteTimeout how long the server has to send the
+	// response once the request header has been read. Zero means no limit.
+	// Handlers can move either deadline for the request they are serving
+	// with the response.Writer's SetReadDeadline and SetWriteDeadline.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a kept-alive connection may sit without a new
+	// request before it is closed. Zero means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+	// MaxRequestsPerConn caps how many requests are served on one
+	// connection. Zero means DefaultMaxRequestsPerConn, negative means no cap.
+	MaxRequestsPerConn int
+	// StreamBody hands requests to the handler as soon as their headers are
+	// parsed, leaving the body to be read from Request.BodyReader. Otherwise
+	// the whole body is read into Request.Body first, except for requests
+	// with "Expect: 100-continue": those are always streamed, so that the
+	// client is only told to send the body once the handler reads it, and
+	// a handler can refuse it unread with 413 or 417.
+	StreamBody bool
+	// Limits bounds the size of incoming requests. Requests over a limit
+	// are answered with 414, 431 or 413 and the connection is closed.
+	Limits request.Limits
+	// ObsFold is what to do with header lines folded onto the next line:
+	// answer 400, the default, or join them with a space.
+	ObsFold headers.ObsFold
+	// Logger receives errors the server can't report to a client, such as
+	// panics in handlers. Nil means the log package's standard logger.
+	Logger Logger
+	// OnPanic, if set, is called with the request, the recovered value and
+	// the stack of every handler panic, after it has been logged.
+	OnPanic func(req *request.Request, v any, stack []byte)
+	// OnConnect, if set, is called with every accepted connection before it
+	// is served. Returning false closes it at once.
+	OnConnect func(c net.Conn) bool
+	// OnDisconnect, if set, is called once a served connection has been
+	// closed.
+	OnDisconnect func(c net.Conn)
+}
+
+// ErrServerClosed is returned by Serve and ListenAndServe once the server
+// has been stopped with Shutdown or Close.
+var ErrServerClosed = errors.New("server closed")
+
+// Logger is where a Server logs. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
 type Server struct {
+	addr              string
+	network           string
+	tlsConfig         *tls.Config
+	handler           Handler
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxRequests       int
+	streamBody        bool
+	limits            request.Limits
+	obsFold           headers.ObsFold
+	logger            Logger
+	onPanic           func(req *request.Request, v any, stack []byte)
+	onConnect         func(c net.Conn) bool
+	onDisconnect      func(c net.Conn)
+
+	mu       sync.Mutex
 	listener net.Listener
-	closed   atomic.Bool
-	handler  Handler
+	closed   bool
+	// done is closed when the server started by Start stops, with the
+	// error it stopped with in serveErr
+	done     chan struct{}
+	serveErr error
+
+	conns      map[*conn]struct{}
+	inShutdown bool
+	onShutdown []func()
 }
 
 type HandlerError struct {
 	statusCode response.StatusCode
 	message    string
+	// allow lists the methods a 405 response names in Allow, or nil for
+	// every method the server accepts
+	allow []string
+}
+
+// NewHandlerError returns an error a handler can return to have the server
+// answer with statusCode and a page showing message, escaped as HTML. An
+// empty message leaves the server's own text for the status.
+func NewHandlerError(statusCode response.StatusCode, message string) *HandlerError {
+	return &HandlerError{statusCode: statusCode, message: message}
+}
+
+// WithAllow sets the methods the target does support, sent in the Allow
+// header of a 405 response.
+func (he *HandlerError) WithAllow(methods ...string) *HandlerError {
+	he.allow = methods
+	return he
+}
+
+func (he *HandlerError) StatusCode() response.StatusCode {
+	return he.statusCode
 }
 
 type Handler func(w io.Writer, req *request.Request) *HandlerError
 
-func Serve(handler Handler, port int) (*Server, error) {
-	addr := fmt.Sprintf(":%d", port)
-	l, err := net.Listen("tcp", addr)
+// New returns a Server for cfg. It doesn't listen until ListenAndServe,
+// Serve or Start is called.
+func New(cfg Config) *Server {
+	s := &Server{
+		addr:              cfg.Addr,
+		network:           cfg.Network,
+		tlsConfig:         cfg.TLSConfig,
+		handler:           cfg.Handler,
+		readHeaderTimeout: cfg.ReadHeaderTimeout,
+		readTimeout:       cfg.ReadTimeout,
+		writeTimeout:      cfg.WriteTimeout,
+		idleTimeout:       cfg.IdleTimeout,
+		maxRequests:       cfg.MaxRequestsPerConn,
+		streamBody:        cfg.StreamBody,
+		limits:            cfg.Limits,
+		obsFold:           cfg.ObsFold,
+		logger:            cfg.Logger,
+		onPanic:           cfg.OnPanic,
+		onConnect:         cfg.OnConnect,
+		onDisconnect:      cfg.OnDisconnect,
+		done:              make(chan struct{}),
+	}
+	if s.network == "" {
+		s.network = "tcp"
+	}
+	if s.readHeaderTimeout == 0 {
+		s.readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if s.idleTimeout == 0 {
+		s.idleTimeout = DefaultIdleTimeout
+	}
+	if s.maxRequests == 0 {
+		s.maxRequests = DefaultMaxRequestsPerConn
+	}
+	return s
+}
+
+// ListenAndServe listens on the configured address and serves connections
+// until the server is stopped, when it returns ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on l until the server is stopped,
+// when it returns ErrServerClosed. l is closed on return.
+func (s *Server) Serve(l net.Listener) error {
+	l, err := s.setListener(l)
 	if err != nil {
-		return nil, fmt.Errorf("Error creating listener %s", err)
+		return err
+	}
+	return s.serve(l)
+}
+
+// Start listens on the configured address and serves in the background,
+// so once it returns Addr reports the address the server is bound to. Wait
+// blocks until it stops.
+func (s *Server) Start() error {
+	l, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	if l, err = s.setListener(l); err != nil {
+		return err
+	}
+	go func() {
+		s.serveErr = s.serve(l)
+		close(s.done)
+	}()
+	return nil
+}
+
+// Wait blocks until a server started with Start stops. It returns nil if
+// it was stopped with Shutdown or Close, and otherwise the error it stopped
+// on.
+func (s *Server) Wait() error {
+	<-s.done
+	if errors.Is(s.serveErr, ErrServerClosed) {
+		return nil
 	}
-	s := &Server{listener: l, handler: handler}
-	go s.listen()
-	return s, nil
+	return s.serveErr
 }
 
+// Addr returns the address the server is listening on, or nil if it isn't.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) setListener(l net.Listener) (net.Listener, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closed:
+		l.Close()
+		return nil, ErrServerClosed
+	case s.listener != nil:
+		l.Close()
+		return nil, errors.New("server: already serving")
+	}
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+	}
+	s.listener = l
+	return l, nil
+}
+
+// Close stops the server at once, closing the listener and every
+// connection whether or not it is in the middle of a request. Shutdown
+// stops it gracefully.
 func (s *Server) Close() error {
-	if s.closed.Swap(true) {
+	err := s.closeListener()
+	s.closeConns()
+	return err
+}
+
+func (s *Server) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.listener == nil {
 		return nil
 	}
 	return s.listener.Close()
 }
 
-func (s *Server) listen() {
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// maxAcceptDelay caps how long serve backs off after a failed Accept, such
+// as when the process is out of file descriptors.
+const maxAcceptDelay = time.Second
+
+func (s *Server) serve(l net.Listener) error {
+	defer l.Close()
+	var delay time.Duration
 	for {
-		conn, err := s.listener.Accept()
+		nc, err := l.Accept()
 		if err != nil {
-			if s.closed.Load() {
-				return
+			if s.isClosed() {
+				return ErrServerClosed
 			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+			s.logf("server: accept: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
 			continue
 		}
+		delay = 0
+
+		if s.onConnect != nil && !s.onConnect(nc) {
+			nc.Close()
+			continue
+		}
+		// tracked before handle starts so Shutdown can't miss it
+		conn := s.track(nc)
+		if conn == nil {
+			nc.Close()
+			return ErrServerClosed
+		}
 		go s.handle(conn)
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+func (s *Server) logf(format string, v ...any) {
+	if s.logger == nil {
+		log.Printf(format, v...)
+		return
+	}
+	s.logger.Printf(format, v...)
+}
+
+func (s *Server) handle(conn *conn) {
+	defer func() {
+		conn.Close()
+		s.untrack(conn)
+		if s.onDisconnect != nil {
+			s.onDisconnect(conn.Conn)
+		}
+	}()
+	// a panic outside a handler only takes its own connection down
+	defer func() {
+		if v := recover(); v != nil {
+			s.logf("server: panic serving %s: %v\n%s", conn.RemoteAddr(), v, debug.Stack())
+		}
+	}()
 
-	req, err := request.RequestFromReader(conn)
+	// responses are buffered and flushed once each is finished, while the
+	// write deadline of its request still applies
+	bw := bufio.NewWriter(conn)
+	defer bw.Flush()
+	rr := request.NewReader(&flushReader{r: conn, w: bw, c: conn})
+	rr.Limits = s.limits
+	rr.ObsFold = s.obsFold
+
+	conn.setDeadline(conn.SetReadDeadline, s.readHeaderTimeout)
+	for served := 1; ; served++ {
+		if served > 1 {
+			// a connection with nothing more buffered is idle until the
+			// next request starts to arrive, and Shutdown may close it
+			if s.shuttingDown() {
+				return
+			}
+			// deadlines are per request, so none of those the last one
+			// set, or its handler moved, carry over; the response to it
+			// has been flushed by now
+			_ = conn.SetWriteDeadline(time.Time{})
+			if rr.Buffered() > 0 {
+				if !conn.next() {
+					return
+				}
+			} else {
+				if !conn.setState(stateIdle) {
+					return
+				}
+				conn.setDeadline(conn.SetReadDeadline, s.idleTimeout)
+			}
+		}
+
+		req, err := rr.ReadRequestHeader()
+		if err != nil {
+			switch {
+			// the client hung up or went quiet between requests, or the
+			// server closed the connection
+			case errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed):
+				return
+			case errors.Is(err, os.ErrDeadlineExceeded) && !conn.active():
+				return
+			}
+			conn.setDeadline(conn.SetWriteDeadline, s.writeTimeout)
+			(&HandlerError{statusCode: statusForError(err)}).Write(bw)
+			return
+		}
+		// the read timeout runs from when the request started to arrive
+		if !conn.activate() {
+			return
+		}
+		var readDeadline time.Time
+		if s.readTimeout > 0 {
+			readDeadline = conn.started().Add(s.readTimeout)
+		}
+		_ = conn.SetReadDeadline(readDeadline)
+		conn.setDeadline(conn.SetWriteDeadline, s.writeTimeout)
+
+		newWriter := func() *response.Writer {
+			rw := response.NewWriter(bw)
+			rw.SetConn(conn)
+			rw.SetVersion(req.RequestLine.HttpVersion)
+			rw.SetMethod(req.RequestLine.Method)
+			return rw
+		}
+		rw := newWriter()
+		rw.SetKeepAlive(req.KeepAlive() && (s.maxRequests < 0 || served < s.maxRequests) && !s.shuttingDown())
+
+		if err := s.prepareBody(rw, req); err != nil {
+			rw.SetKeepAlive(false)
+			(&HandlerError{statusCode: statusForError(err)}).Write(rw)
+			return
+		}
+
+		if s.handler == nil {
+			(&HandlerError{statusCode: response.InternalServerError}).Write(rw)
+			return
+		}
+
+		he, panicked := s.runHandler(rw, req)
+		if panicked || he != nil && rw.StatusWritten() {
+			// what the handler wrote can't be trusted to be whole: until
+			// its headers are out it can be replaced, after that the only
+			// thing left to do is drop the connection
+			bw.Reset(conn)
+			if rw.HeadersSent() {
+				return
+			}
+			if panicked {
+				he = &HandlerError{statusCode: response.InternalServerError}
+			}
+			rw = newWriter()
+			rw.SetKeepAlive(false)
+		}
+		if he != nil {
+			he.Write(rw)
+		}
+
+		if err := rw.Finish(); err != nil || !rw.KeepAlive() {
+			return
+		}
+		if err := bw.Flush(); err != nil {
+			return
+		}
+
+		// skip whatever the handler left of the body; if that fails the
+		// next request can't be found on this connection
+		if err := req.BodyReader.Close(); err != nil {
+			return
+		}
+	}
+}
+
+// runHandler calls the handler, recovering from a panic in it. The panic
+// is logged with its stack and passed to the OnPanic hook.
+func (s *Server) runHandler(rw *response.Writer, req *request.Request) (he *HandlerError, panicked bool) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		panicked = true
+		stack := debug.Stack()
+		s.logf("server: panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, v, stack)
+		if s.onPanic != nil {
+			s.onPanic(req, v, stack)
+		}
+	}()
+	return s.handler(rw, req), false
+}
+
+// prepareBody deals with any expectation the client sent and, unless the
+// body is streamed, reads it whole into req.Body.
+func (s *Server) prepareBody(rw *response.Writer, req *request.Request) error {
+	expecting, err := expectContinue(rw, req)
 	if err != nil {
-		(&HandlerError{statusCode: response.BadRequest}).Write(conn)
-		return
+		return err
 	}
 
-	if s.handler == nil {
-		(&HandlerError{statusCode: response.InternalServerError}).Write(conn)
-		return
+	// reading a body the client is waiting to be asked for would ask for
+	// it before the handler had a say
+	if s.streamBody || expecting {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.BodyReader)
+	if err != nil {
+		return err
 	}
+	req.Body = body
+	req.BodyReader = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrMethodNotAllowed):
+		return response.MethodNotAllowed
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return response.NotImplemented
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.HTTPVersionNotSupported
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return response.RequestTimeout
+	case errors.Is(err, errExpectationFailed):
+		return response.ExpectationFailed
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.URITooLong
+	case errors.Is(err, request.ErrHeaderTooLarge):
+		return response.RequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.ContentTooLarge
+	default:
+		return response.BadRequest
+	}
+}
 
-	if he := s.handler(conn, req); he != nil {
-		he.Write(conn)
+// flushReader flushes anything written so far, such as a 100 Continue,
+// before blocking on a read, and marks the connection active once bytes
+// arrive.
+type flushReader struct {
+	r io.Reader
+	w *bufio.Writer
+	c *conn
+}
+
+func (f *flushReader) Read(p []byte) (int, error) {
+	if f.w.Buffered() > 0 {
+		if err := f.w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p)
+	if n > 0 && !f.c.activate() {
+		return 0, net.ErrClosed
 	}
+	return n, err
 }
 
 func (he HandlerError) Write(w io.Writer) {
 	rw := response.NewWriter(w)
 	_ = rw.WriteStatusLine(he.statusCode)
 
-	h := headers.NewHeaders()
-	h.Set("content-type", "text/html")
-	_ = rw.WriteHeaders(h)
-
-	var body []byte
+	text := response.StatusText(he.statusCode)
+	heading, message := text, ""
 	switch he.statusCode {
 	case response.BadRequest:
-		body = []byte(`
-<html>
-  <head>
-    <title>400 Bad Request</title>
-  </head>
-  <body>
-    <h1>Bad Request</h1>
-    <p>Your request honestly kinda sucked.</p>
-  </body>
-</html>`)
+		message = "Your request honestly kinda sucked."
+	case response.NotFound:
+		message = "I looked everywhere and came up empty."
+	case response.MethodNotAllowed:
+		message = "I don't know how to do that."
+	case response.RequestTimeout:
+		message = "I got tired of waiting for you."
+	case response.ContentTooLarge:
+		message = "That's way more than I signed up for."
+	case response.URITooLong:
+		message = "I stopped reading your request line halfway through."
+	case response.ExpectationFailed:
+		message = "I can't promise you that."
+	case response.RequestHeaderFieldsTooLarge:
+		message = "Nobody needs that many headers."
 	case response.InternalServerError:
-		body = []byte(`
-<html>
-  <head>
-    <title>500 Internal Server Error</title>
-  </head>
-  <body>
-    <h1>Internal Server Error</h1>
-    <p>Okay, you know what? This one is on me.</p>
-  </body>
-</html>`)
-	default:
-		body = []byte(`
+		message = "Okay, you know what? This one is on me."
+	case response.NotImplemented:
+		message = "I never learned how to do that."
+	case response.HTTPVersionNotSupported:
+		message = "I only speak HTTP/1.0 and HTTP/1.1."
+	case response.Ok:
+		heading, message = "Success!", "Your request was an absolute banger."
+	}
+	if he.message != "" {
+		message = html.EscapeString(he.message)
+	}
+	body := errorPage(fmt.Sprintf("%d %s", he.statusCode, text), heading, message)
+
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("content-type", "text/html")
+	if he.statusCode == response.MethodNotAllowed {
+		allow := he.allow
+		if allow == nil {
+			allow = request.Methods
+		}
+		h.Set("allow", strings.Join(allow, ", "))
+	}
+	_ = rw.WriteHeaders(h)
+	_, _ = rw.WriteBody(body)
+}
+
+func errorPage(title, heading, message string) []byte {
+	return []byte(fmt.Sprintf(`
 <html>
   <head>
-    <title>200 OK</title>
+    <title>%s</title>
   </head>
   <body>
-    <h1>Success!</h1>
-    <p>Your request was an absolute banger.</p>
+    <h1>%s</h1>
+    <p>%s</p>
   </body>
-</html>`)
-	}
-	_, _ = rw.WriteBody(body)
+</html>`, title, heading, message))
 }
@@ -0,0 +1,638 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/httpfromtcp/internal/request"
+	"github.com/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveConn runs s on one end of an in-memory connection and returns the
+// client's end along with a reader over it.
+func serveConn(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	client, srv := net.Pipe()
+	go s.handle(s.track(srv))
+	t.Cleanup(func() { client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client, bufio.NewReader(client)
+}
+
+type testResponse struct {
+	statusLine string
+	headers    map[string]string
+	body       string
+}
+
+// readResponse reads one response framed by Content-Length.
+func readResponse(t *testing.T, br *bufio.Reader) testResponse {
+	t.Helper()
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	resp := testResponse{
+		statusLine: strings.TrimRight(line, "\r\n"),
+		headers:    map[string]string{},
+	}
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, val, _ := strings.Cut(line, ":")
+		resp.headers[strings.ToLower(key)] = strings.TrimSpace(val)
+	}
+	if cl, ok := resp.headers["content-length"]; ok {
+		n, err := strconv.Atoi(cl)
+		require.NoError(t, err)
+		body := make([]byte, n)
+		_, err = io.ReadFull(br, body)
+		require.NoError(t, err)
+		resp.body = string(body)
+	}
+	return resp
+}
+
+func echoHandler(w io.Writer, req *request.Request) *HandlerError {
+	body, err := io.ReadAll(req.BodyReader)
+	if err != nil {
+		return &HandlerError{statusCode: response.BadRequest}
+	}
+	rw := response.NewWriter(w)
+	_ = rw.WriteStatusLine(response.Ok)
+	_ = rw.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	_, _ = rw.WriteBody(body)
+	return nil
+}
+
+func TestKeepAlive(t *testing.T) {
+	s := &Server{handler: echoHandler, idleTimeout: time.Second, maxRequests: 2}
+	client, br := serveConn(t, s)
+
+	// Test: Connection stays open between requests
+	_, err := io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "hello", resp.body)
+	assert.NotContains(t, resp.headers, "connection")
+
+	// Test: Last request allowed on the connection closes it
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nworld")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "world", resp.body)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPipelining(t *testing.T) {
+	s := &Server{handler: echoHandler, idleTimeout: time.Second, maxRequests: -1}
+	client, br := serveConn(t, s)
+
+	go io.WriteString(client,
+		"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\none"+
+			"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\ntwo"+
+			"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nConnection: close\r\n\r\nthree")
+
+	for _, want := range []string{"one", "two", "three"} {
+		resp := readResponse(t, br)
+		assert.Equal(t, want, resp.body)
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+	s := &Server{handler: echoHandler, idleTimeout: time.Second, maxRequests: -1, streamBody: true}
+	client, br := serveConn(t, s)
+
+	// Test: 100 Continue is sent when the handler reads the body
+	_, err := io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 100 Continue", resp.statusLine)
+	_, err = io.WriteString(client, "hello")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "hello", resp.body)
+	assert.NotContains(t, resp.headers, "connection")
+
+	// Test: Unsupported expectation
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: coffee\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 417 Expectation Failed", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	// Test: Handler rejects without reading the body
+	reject := func(w io.Writer, req *request.Request) *HandlerError {
+		return &HandlerError{statusCode: response.ContentTooLarge}
+	}
+	s = &Server{handler: reject, idleTimeout: time.Second, maxRequests: -1, streamBody: true}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Without streaming the body still isn't invited before the
+	// handler reads it
+	s = &Server{handler: reject, idleTimeout: time.Second, maxRequests: -1}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(rest), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.NotContains(t, string(rest), "100 Continue")
+
+	s = &Server{handler: echoHandler, idleTimeout: time.Second, maxRequests: -1}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 100 Continue", resp.statusLine)
+	_, err = io.WriteString(client, "hello")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "hello", resp.body)
+	assert.NotContains(t, resp.headers, "connection")
+}
+
+func TestStatusForError(t *testing.T) {
+	s := &Server{
+		handler:     echoHandler,
+		idleTimeout: time.Second,
+		maxRequests: -1,
+		limits:      request.Limits{MaxRequestLine: 64, MaxHeaderBytes: 64, MaxBody: 4},
+	}
+	tests := []struct {
+		name   string
+		raw    string
+		status string
+	}{
+		{"Malformed request line", "GET /\r\n\r\n", "400 Bad Request"},
+		{"Unknown method", "BREW /pot HTTP/1.1\r\nHost: localhost\r\n\r\n", "405 Method Not Allowed"},
+		{"Unknown transfer coding", "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: brew, chunked\r\n\r\n", "501 Not Implemented"},
+		{"Unsupported version", "GET / HTTP/2.0\r\nHost: localhost\r\n\r\n", "505 HTTP Version Not Supported"},
+		{"Long request line", "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\n\r\n", "414 URI Too Long"},
+		{"Large header section", "GET / HTTP/1.1\r\nHost: localhost\r\nX-Junk: " + strings.Repeat("a", 64) + "\r\n\r\n", "431 Request Header Fields Too Large"},
+		{"Large body", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello", "413 Content Too Large"},
+		{"Unsupported expectation", "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 1\r\nExpect: coffee\r\n\r\na", "417 Expectation Failed"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, br := serveConn(t, s)
+			go io.WriteString(client, tc.raw)
+			resp := readResponse(t, br)
+			assert.Equal(t, "HTTP/1.1 "+tc.status, resp.statusLine)
+			assert.Equal(t, "close", resp.headers["connection"])
+			if strings.HasPrefix(tc.status, "405") {
+				assert.Equal(t, strings.Join(request.Methods, ", "), resp.headers["allow"])
+			} else {
+				assert.NotContains(t, resp.headers, "allow")
+			}
+		})
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	// Test: Statuses with their own page show the message instead
+	var b strings.Builder
+	NewHandlerError(response.NotFound, "user 42 not found").Write(&b)
+	assert.Contains(t, b.String(), "<p>user 42 not found</p>")
+	assert.NotContains(t, b.String(), "came up empty")
+
+	// Test: The message is escaped
+	b.Reset()
+	NewHandlerError(response.Forbidden, "<script>x</script>").Write(&b)
+	assert.Contains(t, b.String(), "<h1>Forbidden</h1>")
+	assert.Contains(t, b.String(), "&lt;script&gt;x&lt;/script&gt;")
+
+	// Test: No message leaves the page for the status
+	b.Reset()
+	NewHandlerError(response.NotFound, "").Write(&b)
+	assert.Contains(t, b.String(), "came up empty")
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	var status response.StatusCode
+	var contentType string
+	var written int64
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w io.Writer, req *request.Request) *HandlerError {
+				order = append(order, name)
+				return next(w, req)
+			}
+		}
+	}
+	observe := func(next Handler) Handler {
+		return func(w io.Writer, req *request.Request) *HandlerError {
+			o := Observe(w)
+			he := next(o, req)
+			status, written = o.Status(), o.BytesWritten()
+			contentType, _ = o.Header().Get("Content-Type")
+			return he
+		}
+	}
+
+	s := &Server{handler: Chain(echoHandler, trace("a"), observe, trace("b")), idleTimeout: time.Second, maxRequests: -1}
+	client, br := serveConn(t, s)
+
+	// Test: Middleware runs outermost first and sees what the handler sent
+	_, err := io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "hello", resp.body)
+	assert.Equal(t, []string{"a", "b"}, order)
+	assert.Equal(t, response.Ok, status)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, int64(5), written)
+
+	// Test: Middleware can answer without calling the handler
+	deny := func(next Handler) Handler {
+		return func(w io.Writer, req *request.Request) *HandlerError {
+			return NewHandlerError(response.Forbidden, "no")
+		}
+	}
+	s = &Server{handler: Chain(echoHandler, deny), idleTimeout: time.Second, maxRequests: -1}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 403 Forbidden", resp.statusLine)
+
+	// Test: No middleware
+	assert.NotNil(t, Chain(echoHandler))
+}
+
+type chanLogger chan string
+
+func (l chanLogger) Printf(format string, v ...any) {
+	l <- fmt.Sprintf(format, v...)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	logs := make(chanLogger, 1)
+	panics := make(chan any, 1)
+	handler := func(w io.Writer, req *request.Request) *HandlerError {
+		if req.Target.Path == "/status" || req.Target.Path == "/error" {
+			_ = response.NewWriter(w).WriteStatusLine(response.Ok)
+		}
+		if req.Target.Path == "/error" {
+			return NewHandlerError(response.Forbidden, "no")
+		}
+		if req.Target.Path == "/late" {
+			rw := response.NewWriter(w)
+			_ = rw.WriteStatusLine(response.Ok)
+			_ = rw.WriteHeaders(response.GetDefaultHeaders(10))
+			_, _ = rw.WriteBody([]byte("hello"))
+			_ = rw.Flush()
+		}
+		panic("boom")
+	}
+	onPanic := func(req *request.Request, v any, stack []byte) {
+		assert.Contains(t, string(stack), "TestPanicRecovery")
+		panics <- v
+	}
+	s := &Server{handler: handler, idleTimeout: time.Second, maxRequests: -1, logger: logs, onPanic: onPanic}
+
+	// Test: Panic before the response started is answered with 500
+	client, br := serveConn(t, s)
+	_, err := io.WriteString(client, "GET /early HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	log := <-logs
+	assert.Contains(t, log, "panic serving GET /early: boom")
+	assert.Contains(t, log, "goroutine")
+	assert.Equal(t, "boom", <-panics)
+
+	// Test: A status line without headers is replaced by the 500
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET /status HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	<-logs
+	<-panics
+
+	// Test: So is one followed by a HandlerError
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET /error HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 403 Forbidden", resp.statusLine)
+	assert.Contains(t, resp.body, "<p>no</p>")
+
+	// Test: Panic mid-response drops the connection
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET /late HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(rest), "\r\n\r\nhello"))
+	assert.Contains(t, <-logs, "panic serving GET /late: boom")
+	assert.Equal(t, "boom", <-panics)
+}
+
+func TestShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := func(w io.Writer, req *request.Request) *HandlerError {
+		if req.Target.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		return echoHandler(w, req)
+	}
+	s := New(Config{Addr: "127.0.0.1:0", Handler: handler})
+	require.NoError(t, s.Start())
+	addr := s.Addr().String()
+	dial := func() (net.Conn, *bufio.Reader) {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+		return c, bufio.NewReader(c)
+	}
+
+	// an idle keep-alive connection
+	idle, idleBr := dial()
+	_, err := io.WriteString(idle, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK", readResponse(t, idleBr).statusLine)
+
+	// a connection in the middle of a request
+	busy, busyBr := dial()
+	_, err = io.WriteString(busy, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	hooked := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hooked) })
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+
+	// Test: The hook runs and idle connections are closed at once
+	<-hooked
+	_, err = idleBr.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Test: The request in flight finishes, then its connection closes
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	resp := readResponse(t, busyBr)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	_, err = busyBr.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.NoError(t, <-done)
+	assert.NoError(t, s.Wait())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := func(w io.Writer, req *request.Request) *HandlerError {
+		<-release
+		return nil
+	}
+	s := New(Config{Addr: "127.0.0.1:0", Handler: handler})
+	require.NoError(t, s.Start())
+	c, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(c, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: Connections still busy when the context ends are closed
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for conn := range s.conns {
+			conn.mu.Lock()
+			active := conn.state == stateActive
+			conn.mu.Unlock()
+			return active
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestTimeouts(t *testing.T) {
+	s := &Server{handler: echoHandler, readHeaderTimeout: 50 * time.Millisecond, idleTimeout: time.Second, maxRequests: -1}
+
+	// Test: A header section that stalls is answered with 408
+	client, br := serveConn(t, s)
+	_, err := io.WriteString(client, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: So does a pipelined request that stalls after the first
+	client, br = serveConn(t, s)
+	go io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\nGET / HTTP/1.1\r\nHo")
+	assert.Equal(t, "HTTP/1.1 200 OK", readResponse(t, br).statusLine)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	// Test: A client that never sends anything is hung up on
+	client, br = serveConn(t, s)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: The idle timeout applies between requests
+	s.idleTimeout = 50 * time.Millisecond
+	s.readHeaderTimeout = time.Second
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK", readResponse(t, br).statusLine)
+	start := time.Now()
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: A body that doesn't arrive within the read timeout
+	s = &Server{handler: echoHandler, readTimeout: 50 * time.Millisecond, idleTimeout: time.Second, maxRequests: -1}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhe")
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout", readResponse(t, br).statusLine)
+
+	// Test: Handlers can lift the read timeout for a slow upload
+	upload := func(w io.Writer, req *request.Request) *HandlerError {
+		rw := response.NewWriter(w)
+		require.NoError(t, rw.SetReadDeadline(time.Time{}))
+		require.NoError(t, rw.SetWriteDeadline(time.Now().Add(time.Second)))
+		return echoHandler(w, req)
+	}
+	s = &Server{handler: upload, readTimeout: 50 * time.Millisecond, idleTimeout: time.Second, maxRequests: -1, streamBody: true}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhe")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = io.WriteString(client, "llo")
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "hello", resp.body)
+
+	// Test: A client that stops reading is hung up on after the write timeout
+	s = &Server{handler: echoHandler, writeTimeout: 50 * time.Millisecond, idleTimeout: time.Second, maxRequests: -1}
+	client, br = serveConn(t, s)
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(150 * time.Millisecond)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Deadlines need a connection
+	rw := response.NewWriter(io.Discard)
+	assert.ErrorIs(t, rw.SetReadDeadline(time.Time{}), response.ErrDeadlineNotSupported)
+}
+
+func TestServe(t *testing.T) {
+	connected, disconnected := make(chan net.Conn, 1), make(chan net.Conn, 1)
+	s := New(Config{
+		Addr:    "127.0.0.1:0",
+		Handler: echoHandler,
+		OnConnect: func(c net.Conn) bool {
+			connected <- c
+			return true
+		},
+		OnDisconnect: func(c net.Conn) { disconnected <- c },
+	})
+	assert.Nil(t, s.Addr())
+
+	// Test: Start binds before returning, so the port can be read back
+	require.NoError(t, s.Start())
+	addr := s.Addr().(*net.TCPAddr)
+	assert.NotZero(t, addr.Port)
+	assert.Error(t, s.Start())
+
+	// Test: Connection hooks
+	c, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(c, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\nConnection: close\r\n\r\nhi")
+	require.NoError(t, err)
+	assert.Equal(t, "hi", readResponse(t, bufio.NewReader(c)).body)
+	local := (<-connected).RemoteAddr().String()
+	assert.Equal(t, c.LocalAddr().String(), local)
+	assert.Equal(t, local, (<-disconnected).RemoteAddr().String())
+	c.Close()
+
+	// Test: OnConnect can refuse connections
+	refuse := New(Config{Handler: echoHandler, OnConnect: func(net.Conn) bool { return false }})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- refuse.Serve(l) }()
+	c, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	c.Close()
+
+	// Test: Stopping the server
+	require.NoError(t, s.Close())
+	assert.NoError(t, s.Wait())
+	require.NoError(t, refuse.Close())
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.ErrorIs(t, refuse.ListenAndServe(), ErrServerClosed)
+
+	// Test: Listen errors are returned
+	assert.Error(t, New(Config{Addr: "256.0.0.1:0"}).ListenAndServe())
+}
+
+func TestTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	s := New(Config{
+		Addr:      "127.0.0.1:0",
+		Handler:   echoHandler,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+	})
+	require.NoError(t, s.Start())
+	defer s.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	c, err := tls.Dial("tcp", s.Addr().String(), &tls.Config{RootCAs: roots})
+	require.NoError(t, err)
+	defer c.Close()
+	_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(c, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 6\r\n\r\nsecret")
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(c))
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "secret", resp.body)
+}
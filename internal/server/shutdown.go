@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown looks for connections that
+// have gone idle.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// track starts tracking nc, or returns nil if the server is shutting down.
+func (s *Server) track(nc net.Conn) *conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return nil
+	}
+	if s.conns == nil {
+		s.conns = map[*conn]struct{}{}
+	}
+	c := &conn{Conn: nc, headerTimeout: s.readHeaderTimeout, since: time.Now()}
+	s.conns[c] = struct{}{}
+	return c
+}
+
+func (s *Server) untrack(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// RegisterOnShutdown registers f to be called in its own goroutine when
+// Shutdown starts, so that connections taken over from the server, or
+// other long-lived work, can be wound down too.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Shutdown stops the server gracefully. It stops accepting connections,
+// closes those waiting for a request, and waits for the rest to finish the
+// request they are serving before closing them too. Responses to requests
+// that start once shutdown has begun ask the client to close the
+// connection.
+//
+// If ctx ends first, the remaining connections are closed at once and
+// ctx.Err() is returned. Otherwise the error is the one from closing the
+// listener.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+	err := s.closeListener()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdle() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdle closes the idle connections and reports whether none are left.
+func (s *Server) closeIdle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.closeIdle()
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}